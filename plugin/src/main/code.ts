@@ -28,6 +28,21 @@ type PluginResponse = {
   error?: string;
 };
 
+// Sent while a long request is running; the bridge forwards it to the
+// MCP client as a progress notification
+type ProgressMessage = {
+  type: "progress";
+  requestId: string;
+  progress: number;
+  total?: number;
+  message?: string;
+};
+
+const sendProgress = (message: Omit<ProgressMessage, "type">) => {
+  const progress: ProgressMessage = { type: "progress", ...message };
+  figma.ui.postMessage(progress);
+};
+
 const sendStatus = () => {
   figma.ui.postMessage({
     type: "plugin-status",
@@ -273,6 +288,7 @@ const handleRequest = async (
           );
         }
 
+        let exported = 0;
         const exports = await Promise.all(
           targetNodes.map(async (node) => {
             const settings: ExportSettings =
@@ -289,6 +305,13 @@ const handleRequest = async (
 
             const bytes = await node.exportAsync(settings);
             const base64 = figma.base64Encode(bytes);
+            exported++;
+            sendProgress({
+              requestId: request.requestId,
+              progress: exported,
+              total: targetNodes.length,
+              message: `Exported ${node.name}`,
+            });
             return {
               nodeId: node.id,
               nodeName: node.name,
@@ -320,8 +343,20 @@ const handleRequest = async (
   }
 };
 
-figma.showUI(__html__, { width: 320, height: 180 });
+// The bridge listens on ws://localhost:1994/ws unless a profile or a taken
+// port moved it; the UI lets the user point the plugin elsewhere
+const SERVER_URL_KEY = "serverUrl";
+const DEFAULT_SERVER_URL = "ws://localhost:1994/ws";
+
+const sendSettings = async () => {
+  const serverUrl =
+    (await figma.clientStorage.getAsync(SERVER_URL_KEY)) || DEFAULT_SERVER_URL;
+  figma.ui.postMessage({ type: "settings", payload: { serverUrl } });
+};
+
+figma.showUI(__html__, { width: 320, height: 220 });
 sendStatus();
+sendSettings();
 
 figma.on("selectionchange", () => {
   sendStatus();
@@ -333,6 +368,12 @@ figma.ui.onmessage = async (message) => {
     return;
   }
 
+  if (message.type === "save-settings") {
+    await figma.clientStorage.setAsync(SERVER_URL_KEY, message.serverUrl);
+    await sendSettings();
+    return;
+  }
+
   if (message.type === "server-request") {
     const response = await handleRequest(message.payload as ServerRequest);
     figma.ui.postMessage(response);
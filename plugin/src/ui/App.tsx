@@ -33,10 +33,13 @@ type PluginStatus = {
   selectionCount: number;
 };
 
-const WS_URL = "ws://localhost:1994/ws";
+const SERVICE_RESTART = 1012;
 
 export default function App() {
   const [connected, setConnected] = useState(false);
+  // Set by the main thread from clientStorage; null until it answers
+  const [serverUrl, setServerUrl] = useState<string | null>(null);
+  const [draftUrl, setDraftUrl] = useState("");
   const [status, setStatus] = useState<PluginStatus>({
     fileName: "Unknown file",
     selectionCount: 0
@@ -59,6 +62,12 @@ export default function App() {
         return;
       }
 
+      if (msg.type === "settings") {
+        setServerUrl(msg.payload.serverUrl);
+        setDraftUrl(msg.payload.serverUrl);
+        return;
+      }
+
       if (!("requestId" in msg)) {
         return;
       }
@@ -76,12 +85,24 @@ export default function App() {
   }, []);
 
   useEffect(() => {
+    if (serverUrl === null) {
+      return;
+    }
+    let stopped = false;
+
     const connect = () => {
       if (socketRef.current) {
         socketRef.current.close();
       }
 
-      const ws = new WebSocket(WS_URL);
+      let ws: WebSocket;
+      try {
+        ws = new WebSocket(serverUrl);
+      } catch {
+        // Not a valid ws:// URL; wait for the user to fix it
+        setConnected(false);
+        return;
+      }
       socketRef.current = ws;
 
       ws.onopen = () => {
@@ -89,13 +110,16 @@ export default function App() {
         parent.postMessage({ pluginMessage: { type: "ui-ready" } }, "*");
       };
 
-      ws.onclose = () => {
+      ws.onclose = (event) => {
         setConnected(false);
-        if (reconnectTimer.current === null) {
+        if (!stopped && reconnectTimer.current === null) {
+          // 1012 (service restart) means the leader is handing off to a
+          // successor that binds the port right away
+          const delay = event.code === SERVICE_RESTART ? 250 : 1500;
           reconnectTimer.current = window.setTimeout(() => {
             reconnectTimer.current = null;
             connect();
-          }, 1500);
+          }, delay);
         }
       };
 
@@ -112,16 +136,28 @@ export default function App() {
     connect();
 
     return () => {
+      stopped = true;
       if (reconnectTimer.current !== null) {
         window.clearTimeout(reconnectTimer.current);
+        reconnectTimer.current = null;
       }
       if (socketRef.current) {
         socketRef.current.close();
+        socketRef.current = null;
       }
     };
-  }, []);
-
-  
+  }, [serverUrl]);
+
+  const saveUrl = (event: React.FormEvent) => {
+    event.preventDefault();
+    const url = draftUrl.trim();
+    if (url && url !== serverUrl) {
+      parent.postMessage(
+        { pluginMessage: { type: "save-settings", serverUrl: url } },
+        "*"
+      );
+    }
+  };
 
   return (
     <div className="container">
@@ -137,6 +173,18 @@ export default function App() {
       </div>
       <div className="meta">File: {status.fileName}</div>
       <div className="meta">Selection: {status.selectionCount} node(s)</div>
+      <form className="settings" onSubmit={saveUrl}>
+        <label htmlFor="server-url">Bridge URL</label>
+        <input
+          id="server-url"
+          value={draftUrl}
+          onChange={(event) => setDraftUrl(event.target.value)}
+          spellCheck={false}
+        />
+        <button type="submit" disabled={draftUrl.trim() === serverUrl}>
+          Save
+        </button>
+      </form>
     </div>
   );
 }
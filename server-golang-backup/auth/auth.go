@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultOrigins are the origins the Figma plugin UI connects from in the
+// browser
+var DefaultOrigins = []string{"https://www.figma.com", "https://figma.com"}
+
+// NullOrigin is what browsers send from sandboxed iframes, such as the
+// plugin UI in the Figma desktop app. Every other sandboxed iframe and
+// file:// page sends it too, and any of them could then open /ws and take
+// the plugin's place, so it is only accepted when the user opts in.
+const NullOrigin = "null"
+
+// LoadOrCreateToken returns the shared secret stored at path, generating it
+// on first use. The file is created with user-only permissions so other
+// accounts on the machine cannot read it.
+func LoadOrCreateToken(path string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", fmt.Errorf("failed to create token directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err == nil {
+		defer file.Close()
+		token, err := newToken()
+		if err != nil {
+			return "", err
+		}
+		if _, err := file.WriteString(token + "\n"); err != nil {
+			return "", fmt.Errorf("failed to write token file: %w", err)
+		}
+		return token, nil
+	}
+	if !errors.Is(err, os.ErrExist) {
+		return "", fmt.Errorf("failed to create token file: %w", err)
+	}
+
+	// Another process may be writing the file right now; give it a moment
+	for i := 0; i < 10; i++ {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read token file: %w", err)
+		}
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return "", fmt.Errorf("token file %s is empty", path)
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Require wraps next so that it only serves requests carrying
+// "Authorization: Bearer <token>"
+func Require(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Valid(token, r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Valid reports whether r carries the expected bearer token
+func Valid(token string, r *http.Request) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// SetHeader adds the bearer token to an outgoing request
+func SetHeader(r *http.Request, token string) {
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// Transport is an http.RoundTripper that adds the bearer token to every
+// request, for clients such as the MCP SDK that build requests themselves
+type Transport struct {
+	Token string
+	Base  http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	r = r.Clone(r.Context())
+	SetHeader(r, t.Token)
+	return base.RoundTrip(r)
+}
+
+// Sign returns an HMAC of parts keyed by token. The leader signs its /ping
+// answer with it so followers can tell a real bridge leader, which knows the
+// token, from any other HTTP server that happens to own the port.
+func Sign(token string, parts ...string) string {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether sig is Sign(token, parts...)
+func Verify(token, sig string, parts ...string) bool {
+	return hmac.Equal([]byte(sig), []byte(Sign(token, parts...)))
+}
+
+// OriginChecker returns a websocket CheckOrigin function accepting only the
+// given origins. An entry of "*" allows any origin.
+func OriginChecker(allowed []string) func(*http.Request) bool {
+	set := make(map[string]bool, len(allowed))
+	for _, origin := range allowed {
+		set[strings.TrimSuffix(origin, "/")] = true
+	}
+	return func(r *http.Request) bool {
+		if set["*"] {
+			return true
+		}
+		return set[r.Header.Get("Origin")]
+	}
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestRequire(t *testing.T) {
+	handler := Require("secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name, header string
+		want         int
+	}{
+		{"no header", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer guess", http.StatusUnauthorized},
+		{"not bearer", "Basic secret", http.StatusUnauthorized},
+		{"token prefix", "Bearer secre", http.StatusUnauthorized},
+		{"valid", "Bearer secret", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/rpc", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Fatal("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
+
+func TestValidNeedsAToken(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/rpc", nil)
+	r.Header.Set("Authorization", "Bearer ")
+	if Valid("", r) {
+		t.Fatal("an empty token accepted an empty bearer")
+	}
+	SetHeader(r, "secret")
+	if !Valid("secret", r) {
+		t.Fatal("SetHeader's token not accepted")
+	}
+}
+
+func TestOriginChecker(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{"figma", DefaultOrigins, "https://www.figma.com", true},
+		{"null needs opting in", DefaultOrigins, NullOrigin, false},
+		{"no origin", DefaultOrigins, "", false},
+		{"other site", DefaultOrigins, "https://evil.example", false},
+		{"lookalike", DefaultOrigins, "https://www.figma.com.evil.example", false},
+		{"null opted in", append([]string{NullOrigin}, DefaultOrigins...), NullOrigin, true},
+		{"trailing slash", []string{"http://localhost:3000/"}, "http://localhost:3000", true},
+		{"any", []string{"*"}, "https://evil.example", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := OriginChecker(tt.allowed)(r); got != tt.want {
+				t.Fatalf("origin %q allowed = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	sig := Sign("secret", "nonce", "leader-1", "3")
+	if !Verify("secret", sig, "nonce", "leader-1", "3") {
+		t.Fatal("signature does not verify")
+	}
+	for _, tt := range []struct {
+		name, token string
+		parts       []string
+	}{
+		{"other token", "guess", []string{"nonce", "leader-1", "3"}},
+		{"other epoch", "secret", []string{"nonce", "leader-1", "4"}},
+	} {
+		if Verify(tt.token, sig, tt.parts...) {
+			t.Errorf("%s: signature verifies", tt.name)
+		}
+	}
+}
+
+func TestLoadOrCreateToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "figma-bridge", "token")
+	token, err := LoadOrCreateToken(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) != 64 {
+		t.Fatalf("token %q is not 32 random bytes in hex", token)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0o600 {
+			t.Fatalf("token file mode = %o, want 600", perm)
+		}
+		dir, err := os.Stat(filepath.Dir(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := dir.Mode().Perm(); perm != 0o700 {
+			t.Fatalf("token directory mode = %o, want 700", perm)
+		}
+	}
+
+	again, err := LoadOrCreateToken(path)
+	if err != nil || again != token {
+		t.Fatalf("second load = %q, %v; want the stored %q", again, err, token)
+	}
+
+	existing := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(existing, []byte("  handwritten\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := LoadOrCreateToken(existing); err != nil || got != "handwritten" {
+		t.Fatalf("existing file = %q, %v; want its trimmed token", got, err)
+	}
+}
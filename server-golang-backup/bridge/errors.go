@@ -0,0 +1,130 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Code classifies a failed request so callers, and the agents behind them,
+// can tell whether trying again may help
+type Code string
+
+const (
+	// CodeNotConnected means no plugin is there to answer
+	CodeNotConnected Code = "not_connected"
+	// CodeUnavailable means the leader could not be reached, e.g. during a
+	// handoff
+	CodeUnavailable Code = "unavailable"
+	// CodeTimeout means the plugin did not answer in time
+	CodeTimeout Code = "timeout"
+	// CodeCancelled means the caller gave up on the request
+	CodeCancelled Code = "cancelled"
+	// CodeNodeNotFound means a requested node does not exist or nothing
+	// was selected
+	CodeNodeNotFound Code = "node_not_found"
+	// CodeUnsupported means the plugin does not know the request
+	CodeUnsupported Code = "unsupported"
+	// CodeTooLarge means the answer would be too big to send
+	CodeTooLarge Code = "too_large"
+	// CodePermissionDenied means Figma refused access
+	CodePermissionDenied Code = "permission_denied"
+	// CodeBadRequest means the request itself is malformed, e.g. an invalid
+	// body or parameter, so it never reached the plugin
+	CodeBadRequest Code = "bad_request"
+	// CodeNotFound means the REST API has no such path
+	CodeNotFound Code = "not_found"
+	// CodeInternal covers every other failure
+	CodeInternal Code = "internal"
+)
+
+// Retryable reports whether the same request may succeed if sent again. A
+// cancelled request is not: the caller gave up on it, and retrying it for
+// them would undo that.
+func (c Code) Retryable() bool {
+	switch c {
+	case CodeNotConnected, CodeUnavailable, CodeTimeout:
+		return true
+	}
+	return false
+}
+
+// Hint tells an agent what to do about a failure with this code
+func (c Code) Hint() string {
+	switch c {
+	case CodeNotConnected:
+		return "Open the Figma MCP Bridge plugin in Figma and check its Bridge URL points at this bridge, then retry."
+	case CodeUnavailable:
+		return "The bridge is switching leaders; retry in a few seconds."
+	case CodeTimeout:
+		return "The plugin did not answer in time; retry, or ask for fewer nodes, less depth or a lower scale."
+	case CodeCancelled:
+		return "The request was cancelled before it finished; retry if it is still needed."
+	case CodeNodeNotFound:
+		return "Check the node IDs, e.g. with get_selection or get_document, or select nodes in Figma."
+	case CodeUnsupported:
+		return "The plugin does not support this request; update the Figma plugin."
+	case CodeTooLarge:
+		return "Ask for fewer nodes, less depth or a lower scale."
+	case CodePermissionDenied:
+		return "Figma refused access; check that the file is open with edit or view rights."
+	case CodeBadRequest:
+		return "Fix the request's arguments; sending it unchanged fails the same way."
+	case CodeNotFound:
+		return "Check the path against the API description at /api/v1/openapi.json."
+	}
+	return ""
+}
+
+// Error is a failed request with its code. Errors from the plugin, and those
+// relayed by a leader, are returned as *Error.
+type Error struct {
+	Code    Code
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// CodeOf classifies err; nil has no code
+func CodeOf(err error) Code {
+	var e *Error
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &e):
+		return e.Code
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeTimeout
+	case errors.Is(err, context.Canceled):
+		return CodeCancelled
+	}
+	return CodeInternal
+}
+
+// NewError makes the error for a failure reported as message with code. An
+// empty code is worked out from the message the way the plugin words it.
+func NewError(code Code, message string) *Error {
+	if code == "" {
+		code = classify(message)
+	}
+	return &Error{Code: code, Message: message}
+}
+
+// classify maps the plugin's error messages to codes, for plugins that do
+// not send one
+func classify(message string) Code {
+	lower := strings.ToLower(message)
+	switch {
+	case strings.Contains(lower, "node not found"), strings.Contains(lower, "no nodes to export"):
+		return CodeNodeNotFound
+	case strings.Contains(lower, "unknown request type"):
+		return CodeUnsupported
+	case strings.Contains(lower, "too large"), strings.Contains(lower, "exceeds"):
+		return CodeTooLarge
+	case strings.Contains(lower, "permission"), strings.Contains(lower, "not allowed"):
+		return CodePermissionDenied
+	}
+	return CodeInternal
+}
@@ -0,0 +1,72 @@
+package bridge
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// Origin says which node and MCP client session a request comes from. It is
+// encoded in request IDs so a stray answer can be traced to its caller.
+type Origin struct {
+	Node    string
+	Session string
+}
+
+type originKey struct{}
+
+// WithOrigin returns a context whose requests are tagged with o. Empty
+// fields keep the value already in ctx.
+func WithOrigin(ctx context.Context, o Origin) context.Context {
+	prev := OriginFrom(ctx)
+	if o.Node == "" {
+		o.Node = prev.Node
+	}
+	if o.Session == "" {
+		o.Session = prev.Session
+	}
+	return context.WithValue(ctx, originKey{}, o)
+}
+
+// OriginFrom returns the origin set with WithOrigin, or the zero Origin
+func OriginFrom(ctx context.Context) Origin {
+	o, _ := ctx.Value(originKey{}).(Origin)
+	return o
+}
+
+// SetEpoch sets the leader epoch encoded in request IDs, so plugin logs
+// show which leader sent a request. It must be called before serving.
+func (b *Bridge) SetEpoch(epoch uint64) {
+	b.epoch.Store(epoch)
+}
+
+// Longest node or session tag kept in a request ID
+const maxIDTag = 12
+
+// newRequestID builds "e<epoch>.<node>.<session>.<random>". The random part
+// keeps IDs unique across restarts and processes, so an answer meant for an
+// old leader or a timed out request matches nothing pending; the rest is
+// for humans reading plugin logs.
+func (b *Bridge) newRequestID(o Origin) string {
+	random := make([]byte, 8)
+	_, _ = rand.Read(random)
+	return "e" + strconv.FormatUint(b.epoch.Load(), 10) +
+		"." + idTag(o.Node) +
+		"." + idTag(o.Session) +
+		"." + hex.EncodeToString(random)
+}
+
+func idTag(s string) string {
+	tag := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+	if tag == "" {
+		return "_"
+	}
+	return tag[:min(len(tag), maxIDTag)]
+}
@@ -0,0 +1,92 @@
+package bridge
+
+import (
+	"context"
+	"sync"
+)
+
+// TypeProgress is the type of messages the plugin sends while working on a
+// long request, before its response
+const TypeProgress = "progress"
+
+// Progress is how far the plugin got with a request. Progress grows with
+// every message; Total is zero when unknown.
+type Progress struct {
+	Progress float64 `json:"progress"`
+	Total    float64 `json:"total,omitempty"`
+	Message  string  `json:"message,omitempty"`
+}
+
+// ProgressMessage is how the plugin reports progress on the request with
+// RequestID, e.g. {"type":"progress","requestId":"...","progress":2,"total":5}
+type ProgressMessage struct {
+	Type      string `json:"type"`
+	RequestID string `json:"requestId"`
+	Progress
+}
+
+type progressKey struct{}
+
+// progressQueue is how many updates a slow progress function may fall
+// behind before further ones are dropped
+const progressQueue = 8
+
+// WithProgress returns a context whose requests report the plugin's
+// progress to fn. fn may block, e.g. on a network write: it runs on a
+// goroutine of the request's own, and updates it cannot keep up with are
+// dropped, see AsyncProgress.
+func WithProgress(ctx context.Context, fn func(Progress)) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// AsyncProgress returns a function that queues updates for fn, which runs
+// on a goroutine of its own, so a reader serving many requests can report
+// progress without waiting on any one of them. Updates are dropped while
+// the queue is full; a later one says more anyway. Call stop once the
+// request is answered: it passes on what is still queued, so progress
+// arrives before the response, and ends the goroutine. A nil fn gives a
+// nil report.
+func AsyncProgress(fn func(Progress)) (report func(Progress), stop func()) {
+	if fn == nil {
+		return nil, func() {}
+	}
+	queue := make(chan Progress, progressQueue)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for {
+			select {
+			case p := <-queue:
+				fn(p)
+			case <-done:
+				for {
+					select {
+					case p := <-queue:
+						fn(p)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	report = func(p Progress) {
+		select {
+		case <-done:
+		case queue <- p:
+		default:
+		}
+	}
+	return report, sync.OnceFunc(func() {
+		close(done)
+		<-finished
+	})
+}
+
+// ProgressFrom returns the function set with WithProgress, or nil
+func ProgressFrom(ctx context.Context) func(Progress) {
+	fn, _ := ctx.Value(progressKey{}).(func(Progress))
+	return fn
+}
@@ -0,0 +1,51 @@
+package bridge
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAsyncProgressNeverBlocks(t *testing.T) {
+	release := make(chan struct{})
+	var got []Progress
+	report, stop := AsyncProgress(func(p Progress) {
+		<-release
+		got = append(got, p)
+	})
+
+	// fn is stuck on the first update; the rest queue up or are dropped
+	reported := make(chan struct{})
+	go func() {
+		for i := 1; i <= 100; i++ {
+			report(Progress{Progress: float64(i), Total: 100})
+		}
+		close(reported)
+	}()
+	select {
+	case <-reported:
+	case <-time.After(5 * time.Second):
+		t.Fatal("report blocked on a slow fn")
+	}
+
+	close(release)
+	stop()
+	if len(got) == 0 || len(got) > progressQueue+1 {
+		t.Fatalf("fn got %d updates, want 1 to %d", len(got), progressQueue+1)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].Progress <= got[i-1].Progress {
+			t.Fatalf("updates out of order: %v", got)
+		}
+	}
+	// Late updates go nowhere
+	report(Progress{Progress: 101})
+	if len(got) > progressQueue+1 {
+		t.Fatal("update delivered after stop")
+	}
+
+	if report, stop := AsyncProgress(nil); report != nil {
+		t.Fatal("nil fn gave a report")
+	} else {
+		stop()
+	}
+}
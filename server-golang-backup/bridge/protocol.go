@@ -1,10 +1,27 @@
 package bridge
 
+import "time"
+
+// RequestTypes lists the requests the plugin understands
+var RequestTypes = []string{
+	"get_document",
+	"get_selection",
+	"get_node",
+	"get_styles",
+	"get_metadata",
+	"get_design_context",
+	"get_variable_defs",
+	"get_screenshot",
+}
+
 type Request struct {
 	Type      string                 `json:"type"`
 	RequestID string                 `json:"requestId"`
 	NodeIDs   []string               `json:"nodeIds,omitempty"`
 	Params    map[string]interface{} `json:"params,omitempty"`
+	// TraceID and SpanID let the plugin log which trace a request is part of
+	TraceID string `json:"traceId,omitempty"`
+	SpanID  string `json:"spanId,omitempty"`
 }
 
 type Response struct {
@@ -12,4 +29,11 @@ type Response struct {
 	RequestID string      `json:"requestId"`
 	Data      interface{} `json:"data,omitempty"`
 	Error     string      `json:"error,omitempty"`
+	// Code classifies Error. Plugins may set it; otherwise the bridge
+	// derives it from the message.
+	Code Code `json:"code,omitempty"`
+	// Bytes is the size of the plugin's message as received
+	Bytes int `json:"-"`
+	// Duration is how long the plugin took to answer
+	Duration time.Duration `json:"-"`
 }
@@ -0,0 +1,32 @@
+package bridge
+
+import "context"
+
+// Relay is a plugin reached through another process instead of the
+// bridge's own WebSocket, see package relay
+type Relay interface {
+	// Active reports whether a relay is connected
+	Active() bool
+	SendWithParams(ctx context.Context, requestType string, nodeIDs []string, params map[string]interface{}) (Response, error)
+}
+
+// SetRelay makes the bridge send requests through r while no plugin is
+// connected directly. They are traced and recorded like any other. It must
+// be set before the bridge serves requests.
+func (b *Bridge) SetRelay(r Relay) {
+	b.relay = r
+}
+
+// route sends req to the plugin connected directly, or else through the
+// relay if one is connected
+func (b *Bridge) route(ctx context.Context, req Request) (Response, error) {
+	if b.relay == nil || b.getConn() != nil || !b.relay.Active() {
+		return b.send(ctx, req)
+	}
+	resp, err := b.relay.SendWithParams(ctx, req.Type, req.NodeIDs, req.Params)
+	if resp.Type != "" || resp.Error != "" {
+		// The plugin answered, so record it as an answer
+		resp.RequestID = req.RequestID
+	}
+	return resp, err
+}
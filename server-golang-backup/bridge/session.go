@@ -0,0 +1,185 @@
+package bridge
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Exchange is one line of a session file: a request sent to the plugin,
+// what came back and how long it took
+type Exchange struct {
+	Time       time.Time `json:"time"`
+	DurationMs float64   `json:"durationMs"`
+	Request    Request   `json:"request"`
+	// Response is set when the plugin answered, even with an error
+	Response *Response `json:"response,omitempty"`
+	// Error is set when the bridge gave up without an answer, e.g. because
+	// the plugin was not connected or the request timed out
+	Error string `json:"error,omitempty"`
+}
+
+// ErrNotRecorded is returned while replaying a request the session has no
+// answer for
+var ErrNotRecorded = errors.New("no recorded answer")
+
+// Record appends every request and its outcome to the JSONL session file
+// at path until StopRecording is called
+func (b *Bridge) Record(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if old := b.recorder.Swap(&recorder{file: f, enc: json.NewEncoder(f)}); old != nil {
+		old.close()
+	}
+	return nil
+}
+
+// StopRecording closes the session file, if recording
+func (b *Bridge) StopRecording() error {
+	if r := b.recorder.Swap(nil); r != nil {
+		return r.close()
+	}
+	return nil
+}
+
+// Replay makes the bridge answer from the session file at path instead of
+// the plugin. Requests are matched on type, node IDs and params; repeated
+// requests get the recorded answers in order, then the last one again.
+func (b *Bridge) Replay(path string) error {
+	exchanges, err := LoadSession(path)
+	if err != nil {
+		return err
+	}
+	r := &replayer{answers: make(map[string][]Exchange), next: make(map[string]int)}
+	for _, ex := range exchanges {
+		key := replayKey(ex.Request.Type, ex.Request.NodeIDs, ex.Request.Params)
+		r.answers[key] = append(r.answers[key], ex)
+	}
+	b.replay.Store(r)
+	return nil
+}
+
+// Replaying reports whether the bridge answers from a recorded session
+func (b *Bridge) Replaying() bool {
+	return b.replay.Load() != nil
+}
+
+// LoadSession reads the exchanges of a session file
+func LoadSession(path string) ([]Exchange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var exchanges []Exchange
+	scanner := bufio.NewScanner(f)
+	// Screenshots make for long lines
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var ex Exchange
+		if err := json.Unmarshal(scanner.Bytes(), &ex); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		exchanges = append(exchanges, ex)
+	}
+	return exchanges, scanner.Err()
+}
+
+type recorder struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+func (r *recorder) record(req Request, resp Response, err error, started time.Time) {
+	ex := Exchange{
+		Time:       started,
+		DurationMs: float64(time.Since(started).Microseconds()) / 1000,
+		Request:    req,
+	}
+	if resp.RequestID != "" {
+		ex.Response = &resp
+	} else if err != nil {
+		ex.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// A failed write must not fail the request; the session just misses it
+	_ = r.enc.Encode(ex)
+}
+
+func (r *recorder) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+type replayer struct {
+	mu      sync.Mutex
+	answers map[string][]Exchange
+	next    map[string]int
+}
+
+func (r *replayer) answer(requestType string, nodeIDs []string, params map[string]interface{}) (Response, error) {
+	key := replayKey(requestType, nodeIDs, params)
+
+	r.mu.Lock()
+	answers := r.answers[key]
+	i := r.next[key]
+	if i < len(answers)-1 {
+		r.next[key] = i + 1
+	}
+	r.mu.Unlock()
+
+	if len(answers) == 0 {
+		return Response{}, fmt.Errorf("%w for %s %v", ErrNotRecorded, requestType, nodeIDs)
+	}
+	ex := answers[min(i, len(answers)-1)]
+	if ex.Response == nil {
+		return Response{}, replayedError(ex.Error)
+	}
+	if ex.Response.Error != "" {
+		return *ex.Response, NewError(ex.Response.Code, ex.Response.Error)
+	}
+	return *ex.Response, nil
+}
+
+// replayedError turns a recorded error back into the sentinel it came from,
+// so callers handle it as they did live
+func replayedError(message string) error {
+	for _, err := range []error{ErrNotConnected, ErrDisconnected, context.DeadlineExceeded, context.Canceled} {
+		if message == err.Error() {
+			return err
+		}
+	}
+	return errors.New(message)
+}
+
+// replayKey identifies a request regardless of its ID. Params go through
+// JSON so an int and the float64 it was recorded as match.
+func replayKey(requestType string, nodeIDs []string, params map[string]interface{}) string {
+	if len(nodeIDs) == 0 {
+		nodeIDs = nil
+	}
+	if len(params) == 0 {
+		params = nil
+	}
+	key, _ := json.Marshal(struct {
+		Type    string                 `json:"type"`
+		NodeIDs []string               `json:"nodeIds"`
+		Params  map[string]interface{} `json:"params"`
+	}{requestType, nodeIDs, params})
+	return string(key)
+}
@@ -0,0 +1,88 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTimeout is how long a request waits for the plugin when
+	// neither the caller nor the configuration say otherwise
+	DefaultTimeout = 30 * time.Second
+	// MaxTimeout caps the timeout a caller can ask for
+	MaxTimeout = 10 * time.Minute
+)
+
+// defaultTimeouts suit what each request makes the plugin do: reading the
+// selection is instant, exporting large frames as PDF is not
+var defaultTimeouts = Timeouts{
+	"get_selection":  10 * time.Second,
+	"get_metadata":   10 * time.Second,
+	"get_screenshot": 2 * time.Minute,
+}
+
+// Timeouts maps request types to how long they wait for the plugin
+type Timeouts map[string]time.Duration
+
+// For returns the timeout for requestType: the one in t, else the type's
+// default, else DefaultTimeout
+func (t Timeouts) For(requestType string) time.Duration {
+	if d, ok := t[requestType]; ok {
+		return d
+	}
+	if d, ok := defaultTimeouts[requestType]; ok {
+		return d
+	}
+	return DefaultTimeout
+}
+
+// ParseTimeouts parses comma-separated type=duration pairs, e.g.
+// "get_screenshot=5m,get_selection=5s"
+func ParseTimeouts(value string) (Timeouts, error) {
+	t := make(Timeouts)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, duration, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid timeout %q (want type=duration)", item)
+		}
+		d, err := ParseTimeout(duration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout for %s: %w", name, err)
+		}
+		t[strings.TrimSpace(name)] = d
+	}
+	return t, nil
+}
+
+// ParseTimeout parses a positive duration such as "90s" or "5m"
+func ParseTimeout(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("timeout %s is not positive", value)
+	}
+	return d, nil
+}
+
+// ClampTimeout limits a timeout asked for by a caller to MaxTimeout
+func ClampTimeout(d time.Duration) time.Duration {
+	return min(d, MaxTimeout)
+}
+
+// TimeoutMillis is the time left before ctx's deadline, for passing the
+// deadline on to another process; 0 if ctx has none
+func TimeoutMillis(ctx context.Context) int64 {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	return max(time.Until(deadline).Milliseconds(), 1)
+}
@@ -6,24 +6,47 @@ import (
 	"errors"
 	"log"
 	"net/http"
-	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+
+	"figma-mcp-bridge-v2/trace"
 )
 
+// ErrNotConnected is returned when no plugin is connected to the bridge
+var ErrNotConnected = &Error{Code: CodeNotConnected, Message: "plugin not connected"}
+
+// ErrDisconnected is returned for requests the plugin had not answered when
+// its connection dropped or was replaced by a new one
+var ErrDisconnected = &Error{Code: CodeNotConnected, Message: "plugin disconnected before answering"}
+
+// pendingRequest is a request sent to the plugin and not answered yet
+type pendingRequest struct {
+	ch       chan Response
+	progress func(Progress)
+	conn     *websocket.Conn // the connection it was sent on
+}
+
 type Bridge struct {
 	addr      string
 	upgrader  websocket.Upgrader
 	connMu    sync.RWMutex
 	conn      *websocket.Conn
-	pending   map[string]chan Response
+	writeMu   sync.Mutex // one writer at a time on conn
+	connAt    time.Time
+	lostAt    time.Time // when the plugin last disconnected, or creation
+	timeouts  atomic.Int32
+	pending   map[string]*pendingRequest
 	pendingMu sync.Mutex
-	counter   uint64
+	epoch     atomic.Uint64
 	mux       *http.ServeMux
 	server    *http.Server
+	onConn    func(connected bool)
+	recorder  atomic.Pointer[recorder]
+	replay    atomic.Pointer[replayer]
+	relay     Relay
 }
 
 func NewBridge(addr string) *Bridge {
@@ -34,11 +57,24 @@ func NewBridge(addr string) *Bridge {
 				return true
 			},
 		},
-		pending: make(map[string]chan Response),
+		pending: make(map[string]*pendingRequest),
 		mux:     http.NewServeMux(),
+		lostAt:  time.Now(),
 	}
 }
 
+// SetOriginCheck replaces the function deciding which Origin headers may
+// open the plugin WebSocket
+func (b *Bridge) SetOriginCheck(check func(r *http.Request) bool) {
+	b.upgrader.CheckOrigin = check
+}
+
+// SetConnectionHook registers a function called whenever the plugin
+// connects or disconnects. It must be set before the bridge serves requests.
+func (b *Bridge) SetConnectionHook(hook func(connected bool)) {
+	b.onConn = hook
+}
+
 // Mux returns the HTTP mux so additional handlers can be registered
 func (b *Bridge) Mux() *http.ServeMux {
 	return b.mux
@@ -77,16 +113,55 @@ func (b *Bridge) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	b.setConn(conn)
+	if b.onConn != nil {
+		b.onConn(true)
+	}
 	go b.readLoop(conn)
 }
 
 func (b *Bridge) setConn(conn *websocket.Conn) {
 	b.connMu.Lock()
-	defer b.connMu.Unlock()
-	if b.conn != nil {
-		_ = b.conn.Close()
+	old := b.conn
+	if old != nil {
+		_ = old.Close()
 	}
 	b.conn = conn
+	b.connAt = time.Now()
+	b.timeouts.Store(0)
+	b.connMu.Unlock()
+
+	// The new plugin never saw what was sent to the old one
+	if old != nil {
+		b.failPending(old)
+	}
+}
+
+// ConnectedAt reports when the current plugin connection was established,
+// and false if no plugin is connected
+func (b *Bridge) ConnectedAt() (time.Time, bool) {
+	b.connMu.RLock()
+	defer b.connMu.RUnlock()
+	if b.conn == nil {
+		return time.Time{}, false
+	}
+	return b.connAt, true
+}
+
+// DisconnectedSince reports since when no plugin has been connected, and
+// false if one is connected now
+func (b *Bridge) DisconnectedSince() (time.Time, bool) {
+	b.connMu.RLock()
+	defer b.connMu.RUnlock()
+	if b.conn != nil {
+		return time.Time{}, false
+	}
+	return b.lostAt, true
+}
+
+// Timeouts returns how many requests in a row the plugin failed to answer
+// in time. A plugin that is connected but stuck keeps this growing.
+func (b *Bridge) Timeouts() int {
+	return int(b.timeouts.Load())
 }
 
 func (b *Bridge) readLoop(conn *websocket.Conn) {
@@ -101,24 +176,56 @@ func (b *Bridge) readLoop(conn *websocket.Conn) {
 			log.Printf("Invalid response: %v", err)
 			continue
 		}
+		resp.Bytes = len(payload)
+		if resp.Type == TypeProgress {
+			b.reportProgress(resp.RequestID, payload)
+			continue
+		}
 		b.pendingMu.Lock()
-		ch := b.pending[resp.RequestID]
-		if ch != nil {
+		p := b.pending[resp.RequestID]
+		if p != nil {
 			delete(b.pending, resp.RequestID)
 		}
 		b.pendingMu.Unlock()
-		if ch != nil {
-			ch <- resp
+		if p == nil {
+			// Request IDs are random, so this answers a request that timed
+			// out or came from the leader before us; that caller is gone
+			// and the answer must not count as ours
+			log.Printf("Ignoring response %s nobody waits for", resp.RequestID)
+			continue
 		}
+		p.ch <- resp
+		b.timeouts.Store(0)
 	}
 }
 
 func (b *Bridge) clearConn(conn *websocket.Conn) {
 	b.connMu.Lock()
-	if b.conn == conn {
+	cleared := b.conn == conn
+	if cleared {
 		b.conn = nil
+		b.lostAt = time.Now()
 	}
 	b.connMu.Unlock()
+
+	// Nobody is left to answer what was sent on this connection, even if
+	// a newer one replaced it already
+	b.failPending(conn)
+	if cleared && b.onConn != nil {
+		b.onConn(false)
+	}
+}
+
+// failPending fails the requests sent on conn with ErrDisconnected
+func (b *Bridge) failPending(conn *websocket.Conn) {
+	b.pendingMu.Lock()
+	defer b.pendingMu.Unlock()
+	for id, p := range b.pending {
+		if p.conn == conn {
+			close(p.ch)
+			delete(b.pending, id)
+		}
+	}
 }
 
 func (b *Bridge) Send(ctx context.Context, requestType string, nodeIDs []string) (Response, error) {
@@ -126,30 +233,55 @@ func (b *Bridge) Send(ctx context.Context, requestType string, nodeIDs []string)
 }
 
 func (b *Bridge) SendWithParams(ctx context.Context, requestType string, nodeIDs []string, params map[string]interface{}) (Response, error) {
-	conn := b.getConn()
-	if conn == nil {
-		return Response{}, errors.New("plugin not connected")
+	if r := b.replay.Load(); r != nil {
+		return r.answer(requestType, nodeIDs, params)
 	}
 
-	requestID := b.nextID()
+	ctx, span := trace.Start(ctx, "plugin "+requestType, trace.KindClient)
 	req := Request{
 		Type:      requestType,
-		RequestID: requestID,
+		RequestID: b.newRequestID(OriginFrom(ctx)),
 		NodeIDs:   nodeIDs,
 		Params:    params,
+		TraceID:   span.Context().TraceID,
+		SpanID:    span.Context().SpanID,
+	}
+	span.SetAttr("figma_bridge.request_id", req.RequestID)
+	started := time.Now()
+	resp, err := b.route(ctx, req)
+	if resp.Bytes > 0 {
+		span.SetAttr("figma_bridge.response_bytes", resp.Bytes)
+	}
+	resp.Duration = span.End(err)
+	if r := b.recorder.Load(); r != nil {
+		r.record(req, resp, err, started)
+	}
+	return resp, err
+}
+
+func (b *Bridge) send(ctx context.Context, req Request) (Response, error) {
+	conn := b.getConn()
+	if conn == nil {
+		return Response{}, ErrNotConnected
 	}
 
+	requestID := req.RequestID
 	data, err := json.Marshal(req)
 	if err != nil {
 		return Response{}, err
 	}
 
 	respCh := make(chan Response, 1)
+	progress, stopProgress := AsyncProgress(ProgressFrom(ctx))
+	defer stopProgress()
 	b.pendingMu.Lock()
-	b.pending[requestID] = respCh
+	b.pending[requestID] = &pendingRequest{ch: respCh, progress: progress, conn: conn}
 	b.pendingMu.Unlock()
 
-	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+	b.writeMu.Lock()
+	err = conn.WriteMessage(websocket.TextMessage, data)
+	b.writeMu.Unlock()
+	if err != nil {
 		b.pendingMu.Lock()
 		delete(b.pending, requestID)
 		b.pendingMu.Unlock()
@@ -157,30 +289,66 @@ func (b *Bridge) SendWithParams(ctx context.Context, requestType string, nodeIDs
 	}
 
 	select {
-	case resp := <-respCh:
+	case resp, ok := <-respCh:
+		if !ok {
+			return Response{}, ErrDisconnected
+		}
 		if resp.Error != "" {
-			return resp, errors.New(resp.Error)
+			err := NewError(resp.Code, resp.Error)
+			resp.Code = err.Code
+			return resp, err
 		}
 		return resp, nil
 	case <-ctx.Done():
 		b.pendingMu.Lock()
 		delete(b.pending, requestID)
 		b.pendingMu.Unlock()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			b.timeouts.Add(1)
+		}
 		return Response{}, ctx.Err()
 	}
 }
 
-func (b *Bridge) getConn() *websocket.Conn {
-	b.connMu.RLock()
-	defer b.connMu.RUnlock()
-	return b.conn
+// reportProgress passes a progress message from the plugin on to whoever
+// waits for the request
+func (b *Bridge) reportProgress(requestID string, payload []byte) {
+	b.pendingMu.Lock()
+	p := b.pending[requestID]
+	b.pendingMu.Unlock()
+	if p == nil || p.progress == nil {
+		return
+	}
+	var msg ProgressMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		log.Printf("Invalid progress for %s: %v", requestID, err)
+		return
+	}
+	p.progress(msg.Progress)
 }
 
-func (b *Bridge) nextID() string {
-	id := atomic.AddUint64(&b.counter, 1)
-	return "req-" + time.Now().Format("150405") + "-" + fmtUint(id)
+// PendingCount returns the number of requests waiting for a plugin response
+func (b *Bridge) PendingCount() int {
+	b.pendingMu.Lock()
+	defer b.pendingMu.Unlock()
+	return len(b.pending)
 }
 
-func fmtUint(value uint64) string {
-	return strconv.FormatUint(value, 10)
+// CloseForRestart closes the plugin connection with a "service restart"
+// close frame so the plugin reconnects right away instead of backing off
+func (b *Bridge) CloseForRestart(reason string) {
+	conn := b.getConn()
+	if conn == nil {
+		return
+	}
+	msg := websocket.FormatCloseMessage(websocket.CloseServiceRestart, reason)
+	_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	_ = conn.Close()
+	b.clearConn(conn)
+}
+
+func (b *Bridge) getConn() *websocket.Conn {
+	b.connMu.RLock()
+	defer b.connMu.RUnlock()
+	return b.conn
 }
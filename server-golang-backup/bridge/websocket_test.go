@@ -0,0 +1,144 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestStaleResponsesAreDropped has the plugin answer with IDs from an older
+// leader and from a request that already timed out before the real answer.
+// Neither may reach the caller or count as the plugin responding.
+func TestStaleResponsesAreDropped(t *testing.T) {
+	b := NewBridge("")
+	b.SetEpoch(2)
+	server := httptest.NewServer(http.HandlerFunc(b.HandleWebSocket))
+	defer server.Close()
+	plugin, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plugin.Close()
+	for b.getConn() == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A request the plugin never answers in time
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := b.Send(ctx, "get_selection", nil); err != context.DeadlineExceeded {
+		t.Fatalf("unanswered request returned %v", err)
+	}
+	var late Request
+	if err := plugin.ReadJSON(&late); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(late.RequestID, "e2.") {
+		t.Fatalf("request ID %q does not carry epoch 2", late.RequestID)
+	}
+	if b.Timeouts() != 1 {
+		t.Fatalf("timeouts = %d, want 1", b.Timeouts())
+	}
+
+	progressed := make(chan struct{})
+	ctx = WithProgress(context.Background(), func(Progress) { close(progressed) })
+	type result struct {
+		resp Response
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := b.Send(ctx, "get_selection", nil)
+		done <- result{resp, err}
+	}()
+	var req Request
+	if err := plugin.ReadJSON(&req); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := "e1" + strings.TrimPrefix(req.RequestID, "e2")
+	for _, msg := range []interface{}{
+		Response{Type: "get_selection", RequestID: stale, Data: "from the old leader"},
+		Response{Type: "get_selection", RequestID: late.RequestID, Data: "too late"},
+		ProgressMessage{Type: TypeProgress, RequestID: req.RequestID, Progress: Progress{Progress: 1}},
+	} {
+		if err := plugin.WriteJSON(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Messages are read in order, so the stale ones were handled by now
+	<-progressed
+	if b.Timeouts() != 1 {
+		t.Fatalf("stale responses reset timeouts to %d", b.Timeouts())
+	}
+	select {
+	case r := <-done:
+		t.Fatalf("request answered by a stale response: %+v, %v", r.resp, r.err)
+	default:
+	}
+
+	if err := plugin.WriteJSON(Response{Type: "get_selection", RequestID: req.RequestID, Data: "ours"}); err != nil {
+		t.Fatal(err)
+	}
+	r := <-done
+	if r.err != nil || r.resp.Data != "ours" {
+		t.Fatalf("got %+v, %v; want our answer", r.resp, r.err)
+	}
+	if b.Timeouts() != 0 || b.PendingCount() != 0 {
+		t.Fatalf("timeouts %d, pending %d after answer", b.Timeouts(), b.PendingCount())
+	}
+}
+
+// TestReplacedConnectionFailsItsRequests connects a second plugin while the
+// first owes an answer. The new plugin never saw that request, so the
+// caller must hear at once that it may retry instead of waiting it out.
+func TestReplacedConnectionFailsItsRequests(t *testing.T) {
+	b := NewBridge("")
+	server := httptest.NewServer(http.HandlerFunc(b.HandleWebSocket))
+	defer server.Close()
+	dial := func() *websocket.Conn {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	first := dial()
+	defer first.Close()
+	for b.getConn() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.Send(ctx, "get_selection", nil)
+		done <- err
+	}()
+	var req Request
+	if err := first.ReadJSON(&req); err != nil {
+		t.Fatal(err)
+	}
+
+	second := dial()
+	defer second.Close()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrDisconnected) || !CodeOf(err).Retryable() {
+			t.Fatalf("request on the replaced connection = %v, want retryable ErrDisconnected", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("request on the replaced connection still waiting")
+	}
+	if n := b.PendingCount(); n != 0 {
+		t.Fatalf("%d requests pending after the replacement", n)
+	}
+}
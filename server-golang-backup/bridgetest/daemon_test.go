@@ -0,0 +1,117 @@
+package bridgetest_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/config"
+)
+
+// buildBridge compiles figma-bridge, whose stdio mode starts the daemon by
+// running its own executable again
+func buildBridge(t *testing.T) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("builds the figma-bridge binary")
+	}
+	exe := filepath.Join(t.TempDir(), "figma-bridge")
+	build := exec.Command("go", "build", "-o", exe, "figma-mcp-bridge-v2")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	return exe
+}
+
+// TestStdioStartsDaemonWithItsConfig runs `stdio` with a profile from a
+// config file elsewhere than the default, plus flags only the daemon acts
+// on. The daemon it starts must resolve the same profile and replay the
+// session.
+func TestStdioStartsDaemonWithItsConfig(t *testing.T) {
+	exe := buildBridge(t)
+	dir := t.TempDir()
+	addr := freeAddr(t)
+	_, port, _ := strings.Cut(addr, ":")
+
+	configFile := filepath.Join(dir, "bridge.json")
+	if err := os.WriteFile(configFile, []byte(`{"profiles": {"design": {"port": `+port+`}}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	session := filepath.Join(dir, "session.jsonl")
+	exchange, _ := json.Marshal(bridge.Exchange{
+		Time:     time.Now(),
+		Request:  bridge.Request{Type: "get_selection", RequestID: "e1._._.1"},
+		Response: &bridge.Response{Type: "get_selection", RequestID: "e1._._.1", Data: []any{map[string]any{"id": "1:2", "name": "Replayed"}}},
+	})
+	if err := os.WriteFile(session, append(exchange, '\n'), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(exe, "stdio", "-config", configFile, "-profile", "design", "-replay", session, "-timeouts", "get_node=7s")
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + dir,
+		"TMPDIR=" + dir,
+		"XDG_CONFIG_HOME=" + filepath.Join(dir, "config"),
+		"XDG_RUNTIME_DIR=" + filepath.Join(dir, "run"),
+		config.EnvToken + "=" + testToken,
+	}
+	t.Cleanup(func() { shutdownDaemon(addr) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client := mcp.NewClient(&mcp.Implementation{Name: "test"}, nil)
+	mcpSession, err := client.Connect(ctx, &mcp.CommandTransport{Command: cmd}, nil)
+	if err != nil {
+		t.Fatalf("stdio: %v", err)
+	}
+	defer mcpSession.Close()
+
+	text, isErr := callTool(t, mcpSession, "get_selection", nil)
+	if isErr || !strings.Contains(text, "Replayed") {
+		t.Fatalf("get_selection through stdio = %s (error %v), want the replayed selection", text, isErr)
+	}
+	if err := ping(ctx, addr); err != nil {
+		t.Fatalf("no daemon on the profile's port %s: %v", port, err)
+	}
+}
+
+// ping checks that something answers /ping at addr
+func ping(ctx context.Context, addr string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.BaseURL(addr)+"/ping", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ping returned %s", resp.Status)
+	}
+	return nil
+}
+
+// shutdownDaemon stops the daemon stdio started, which outlives the test
+// process otherwise
+func shutdownDaemon(addr string) {
+	req, err := http.NewRequest(http.MethodPost, config.BaseURL(addr)+"/shutdown", nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
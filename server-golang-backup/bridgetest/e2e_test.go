@@ -0,0 +1,1234 @@
+package bridgetest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/bridgetest"
+	"figma-mcp-bridge-v2/config"
+	"figma-mcp-bridge-v2/discovery"
+	"figma-mcp-bridge-v2/figmabridge"
+	"figma-mcp-bridge-v2/follower"
+	"figma-mcp-bridge-v2/leader"
+	"figma-mcp-bridge-v2/link"
+	mcpbridge "figma-mcp-bridge-v2/mcp"
+	"figma-mcp-bridge-v2/relay"
+)
+
+// These tests drive mcpbridge.Tools end to end: an MCP client calls a tool,
+// the request goes through the leader (directly or from a follower over
+// /link) to the simulated plugin and back.
+
+const testToken = "test-token"
+
+// sender adapts anything with SendWithParams to mcpbridge.ToolHandler
+type sender interface {
+	SendWithParams(ctx context.Context, requestType string, nodeIDs []string, params map[string]interface{}) (bridge.Response, error)
+}
+
+type toolHandler struct{ sender }
+
+func (h toolHandler) Send(ctx context.Context, requestType string, nodeIDs []string) (bridge.Response, error) {
+	return h.SendWithParams(ctx, requestType, nodeIDs, nil)
+}
+
+// startLeader runs a leader on a free port with a simulated plugin attached
+func startLeader(t *testing.T, opts bridgetest.Options) (*leader.Leader, *bridgetest.Plugin) {
+	t.Helper()
+	return attachPlugin(t, runLeader(t, leader.Options{}), opts)
+}
+
+// runLeader runs a leader on a free port without a plugin
+func runLeader(t *testing.T, opts leader.Options) *leader.Leader {
+	t.Helper()
+	l, _ := runStoppableLeader(t, opts)
+	return l
+}
+
+// runStoppableLeader is runLeader for tests that stop the leader
+// themselves; stop may be called more than once
+func runStoppableLeader(t *testing.T, opts leader.Options) (*leader.Leader, func()) {
+	t.Helper()
+	dir := t.TempDir()
+	opts.Token = testToken
+	opts.AllowedOrigins = []string{"https://www.figma.com"}
+	opts.EpochFile = filepath.Join(dir, "epoch")
+	opts.LockFile = filepath.Join(dir, "run", "leader.lock")
+	l := leader.New("127.0.0.1:0", opts)
+	if err := l.Start(); err != nil {
+		t.Fatalf("leader start: %v", err)
+	}
+	stop := sync.OnceFunc(l.Stop)
+	t.Cleanup(stop)
+	return l, stop
+}
+
+func attachPlugin(t *testing.T, l *leader.Leader, opts bridgetest.Options) (*leader.Leader, *bridgetest.Plugin) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	opts.ReconnectDelay = 20 * time.Millisecond
+	plugin := bridgetest.New(nil, opts)
+	go plugin.Run(ctx, wsURL(l))
+	waitPlugin(t, l, true)
+	return l, plugin
+}
+
+func wsURL(l *leader.Leader) string {
+	return "ws" + strings.TrimPrefix(config.BaseURL(l.Addr()), "http") + "/ws"
+}
+
+func waitPlugin(t *testing.T, l *leader.Leader, connected bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := l.Bridge().ConnectedAt(); ok == connected {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("plugin connected never became %v", connected)
+}
+
+// connectTools serves mcpbridge.Tools over handler and returns a client
+// session talking to it in memory
+func connectTools(t *testing.T, handler sender) *mcp.ClientSession {
+	t.Helper()
+	return connectClient(t, handler, nil)
+}
+
+// connectClient is connectTools with client options
+func connectClient(t *testing.T, handler sender, opts *mcp.ClientOptions) *mcp.ClientSession {
+	t.Helper()
+	server := mcp.NewServer(&mcp.Implementation{Name: "figma-bridge", Version: leader.Version}, nil)
+	tools := &mcpbridge.Tools{Handler: toolHandler{handler}}
+	tools.Register(server)
+
+	ctx := context.Background()
+	serverT, clientT := mcp.NewInMemoryTransports()
+	if _, err := server.Connect(ctx, serverT, nil); err != nil {
+		t.Fatalf("server connect: %v", err)
+	}
+	client := mcp.NewClient(&mcp.Implementation{Name: "test"}, opts)
+	session, err := client.Connect(ctx, clientT, nil)
+	if err != nil {
+		t.Fatalf("client connect: %v", err)
+	}
+	t.Cleanup(func() { session.Close() })
+	return session
+}
+
+// callTool calls a tool and returns its text and whether it is an error
+func callTool(t *testing.T, session *mcp.ClientSession, name string, args map[string]any) (string, bool) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	if len(result.Content) != 1 {
+		t.Fatalf("%s: want one content item, got %d", name, len(result.Content))
+	}
+	text, ok := result.Content[0].(*mcp.TextContent)
+	if !ok {
+		t.Fatalf("%s: want text content, got %T", name, result.Content[0])
+	}
+	return text.Text, result.IsError
+}
+
+func newFollower(t *testing.T, l *leader.Leader) *follower.Follower {
+	t.Helper()
+	f := follower.New(discovery.Locator{URL: config.BaseURL(l.Addr()), Token: testToken}, "follower-1")
+	t.Cleanup(f.Close)
+	return f
+}
+
+func TestToolsThroughLeader(t *testing.T) {
+	l, _ := startLeader(t, bridgetest.Options{})
+	session := connectTools(t, l)
+
+	text, isErr := callTool(t, session, "get_selection", nil)
+	if isErr {
+		t.Fatalf("get_selection failed: %s", text)
+	}
+	// Decoded in the shape of the plugin's serializeNode
+	var selection []struct {
+		Name   string
+		Bounds struct{ X, Y, Width, Height float64 }
+		Styles struct {
+			Fills        []struct{ Type, Color string }
+			CornerRadius float64
+			Padding      struct{ Top, Left float64 }
+		}
+		Children []struct {
+			Type       string
+			Characters string
+		}
+	}
+	if err := json.Unmarshal([]byte(text), &selection); err != nil {
+		t.Fatalf("get_selection returned %q: %v", text, err)
+	}
+	if len(selection) != 1 || selection[0].Name != "Card" {
+		t.Fatalf("get_selection = %s, want the Card frame", text)
+	}
+	card := selection[0]
+	if card.Bounds.Width != 320 || card.Bounds.Height != 200 || card.Styles.CornerRadius != 12 || card.Styles.Padding.Left != 16 ||
+		len(card.Styles.Fills) != 1 || card.Styles.Fills[0].Color != "#ffffff" {
+		t.Fatalf("get_selection = %s, want the Card's bounds and styles", text)
+	}
+	if len(card.Children) != 2 || card.Children[0].Type != "TEXT" || card.Children[0].Characters != "Hello, Figma" {
+		t.Fatalf("get_selection = %s, want the title's characters", text)
+	}
+
+	text, isErr = callTool(t, session, "get_design_context", map[string]any{"depth": 1})
+	if isErr || !strings.Contains(text, `"childCount":1`) {
+		t.Fatalf("get_design_context with depth 1 = %s, want the button's children truncated", text)
+	}
+
+	// Pages are nodes too, without bounds
+	text, isErr = callTool(t, session, "get_node", map[string]any{"nodeId": "0:1"})
+	var page map[string]any
+	if isErr || json.Unmarshal([]byte(text), &page) != nil || page["type"] != "PAGE" || page["bounds"] != nil {
+		t.Fatalf("get_node on the page = %s (error %v), want the page without bounds", text, isErr)
+	}
+
+	text, isErr = callTool(t, session, "get_node", map[string]any{"nodeId": "9:9"})
+	if !isErr || !strings.Contains(text, "Node not found: 9:9") {
+		t.Fatalf("get_node on a missing node = %q (error %v)", text, isErr)
+	}
+}
+
+func TestToolsThroughFollower(t *testing.T) {
+	l, plugin := startLeader(t, bridgetest.Options{})
+	session := connectTools(t, newFollower(t, l))
+
+	text, isErr := callTool(t, session, "get_screenshot", map[string]any{"nodeIds": []string{"1:6"}, "format": "SVG"})
+	if isErr || !strings.Contains(text, `"nodeName":"Logo"`) || !strings.Contains(text, `"format":"SVG"`) {
+		t.Fatalf("get_screenshot = %s (error %v)", text, isErr)
+	}
+
+	plugin.FailWith("get_variable_defs", "variables are unavailable")
+	text, isErr = callTool(t, session, "get_variable_defs", nil)
+	if !isErr || !strings.Contains(text, "variables are unavailable") {
+		t.Fatalf("get_variable_defs with injected error = %q (error %v)", text, isErr)
+	}
+
+	requests := plugin.Requests()
+	if len(requests) != 2 || requests[0].Type != "get_screenshot" || requests[0].Params["format"] != "SVG" {
+		t.Fatalf("plugin saw %+v", requests)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	l, plugin := startLeader(t, bridgetest.Options{Hang: []string{"get_styles"}})
+	session := connectTools(t, l)
+
+	text, isErr := callTool(t, session, "get_node", map[string]any{"nodeId": "9:9"})
+	if !isErr || !strings.Contains(text, "Node not found: 9:9 [node_not_found, not retryable] Check the node IDs") {
+		t.Fatalf("get_node on a missing node = %q (error %v)", text, isErr)
+	}
+
+	// Codes survive the hop from leader to follower
+	f := newFollower(t, l)
+	_, err := f.SendWithParams(context.Background(), "get_node", []string{"9:9"}, nil)
+	if code := bridge.CodeOf(err); code != bridge.CodeNodeNotFound {
+		t.Fatalf("get_node on a missing node through a follower = %v (code %q)", err, code)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = f.SendWithParams(ctx, "get_styles", nil, nil)
+	if code := bridge.CodeOf(err); code != bridge.CodeTimeout || !code.Retryable() {
+		t.Fatalf("get_styles on a hung plugin = %v (code %q), want a retryable timeout", err, code)
+	}
+
+	// A malformed body never reaches the plugin
+	status, body := postRPC(t, l, `{"tool":`)
+	var resp leader.RPCResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil || status != http.StatusBadRequest || resp.Code != bridge.CodeBadRequest {
+		t.Fatalf("malformed /rpc body = %d %s, want 400 with %s", status, body, bridge.CodeBadRequest)
+	}
+
+	plugin.Disconnect()
+	waitPlugin(t, l, false)
+	text, isErr = callTool(t, session, "get_metadata", nil)
+	if !isErr || !strings.Contains(text, "plugin not connected") || !strings.Contains(text, "[not_connected, retryable]") {
+		t.Fatalf("get_metadata while disconnected = %q (error %v)", text, isErr)
+	}
+}
+
+func TestHungPluginTimesOut(t *testing.T) {
+	l, _ := startLeader(t, bridgetest.Options{Hang: []string{"get_styles"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err := newFollower(t, l).SendWithParams(ctx, "get_styles", nil, nil)
+	if err == nil {
+		t.Fatal("get_styles on a hung plugin succeeded")
+	}
+}
+
+// fakeClock runs ahead of the real time by however far the test advanced
+// it, for leader.Options.Now
+type fakeClock struct{ ahead atomic.Int64 }
+
+func (c *fakeClock) Now() time.Time          { return time.Now().Add(time.Duration(c.ahead.Load())) }
+func (c *fakeClock) Advance(d time.Duration) { c.ahead.Add(int64(d)) }
+
+// TestUnresponsivePluginIsClosed lets the plugin leave requests unanswered:
+// the third in a row makes the health check ask it to reconnect
+func TestUnresponsivePluginIsClosed(t *testing.T) {
+	l, _ := startLeader(t, bridgetest.Options{Hang: []string{"get_styles"}})
+	first, _ := l.Bridge().ConnectedAt()
+	timeOut := func() {
+		t.Helper()
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+		defer cancel()
+		if _, err := l.SendWithParams(ctx, "get_styles", nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("hung request = %v, want a timeout", err)
+		}
+	}
+
+	timeOut()
+	timeOut()
+	if err := l.SelfCheck(); err != nil {
+		t.Fatalf("self check: %v", err)
+	}
+	if at, ok := l.Bridge().ConnectedAt(); !ok || !at.Equal(first) {
+		t.Fatal("plugin closed after two timeouts")
+	}
+
+	timeOut()
+	if err := l.SelfCheck(); err != nil {
+		t.Fatalf("self check: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if at, ok := l.Bridge().ConnectedAt(); ok && !at.Equal(first) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("plugin not reconnected after three timeouts in a row")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := l.Bridge().Timeouts(); n != 0 {
+		t.Fatalf("%d timeouts carried over to the new connection", n)
+	}
+}
+
+// TestFallbackLeaderStepsDown starts a leader whose port is taken. Once the
+// port is free and no plugin came for the grace period, it asks to step
+// down so the next leader gets the port the plugin knows.
+func TestFallbackLeaderStepsDown(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := taken.Addr().String()
+	dir := t.TempDir()
+	clock := &fakeClock{}
+	l := leader.New(addr, leader.Options{
+		Token:          testToken,
+		AllowedOrigins: []string{"https://www.figma.com"},
+		EpochFile:      filepath.Join(dir, "epoch"),
+		LockFile:       filepath.Join(dir, "run", "leader.lock"),
+		Now:            clock.Now,
+	})
+	if err := l.Start(); err != nil {
+		taken.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(l.Stop)
+	if l.Addr() == addr {
+		t.Fatalf("leader got the taken port %s", addr)
+	}
+
+	if err := l.SelfCheck(); err != nil {
+		t.Fatalf("stepping down while the port is taken: %v", err)
+	}
+	taken.Close()
+	clock.Advance(29 * time.Second)
+	if err := l.SelfCheck(); err != nil {
+		t.Fatalf("stepping down within the grace period: %v", err)
+	}
+	clock.Advance(2 * time.Second)
+	err = l.SelfCheck()
+	if err == nil || !strings.Contains(err.Error(), "fallback "+l.Addr()) || !strings.Contains(err.Error(), addr+" is free") {
+		t.Fatalf("self check after the grace period = %v, want a step down naming both ports", err)
+	}
+
+	// Someone else took the port meanwhile; moving would not help
+	if taken, err = net.Listen("tcp", addr); err != nil {
+		t.Skipf("port %s reused: %v", addr, err)
+	}
+	defer taken.Close()
+	if err := l.SelfCheck(); err != nil {
+		t.Fatalf("stepping down while the port is taken again: %v", err)
+	}
+}
+
+// TestNotConnectedErrorSaysForHowLong checks the error sent while no plugin
+// is connected says since when and where the plugin should connect
+func TestNotConnectedErrorSaysForHowLong(t *testing.T) {
+	clock := &fakeClock{}
+	l := runLeader(t, leader.Options{Now: clock.Now})
+	clock.Advance(90 * time.Second)
+
+	_, err := l.SendWithParams(context.Background(), "get_selection", nil, nil)
+	if !errors.Is(err, bridge.ErrNotConnected) || bridge.CodeOf(err) != bridge.CodeNotConnected {
+		t.Fatalf("err = %v, want not_connected", err)
+	}
+	for _, want := range []string{"for 1m30s", "ws://" + l.Addr() + "/ws"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not say %q", err, want)
+		}
+	}
+}
+
+func TestLatencyIsInjected(t *testing.T) {
+	l, plugin := startLeader(t, bridgetest.Options{})
+	plugin.SetLatency(150 * time.Millisecond)
+
+	started := time.Now()
+	if _, err := l.SendWithParams(context.Background(), "get_metadata", nil, nil); err != nil {
+		t.Fatalf("get_metadata: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed < 150*time.Millisecond {
+		t.Fatalf("get_metadata took %s, want at least the injected latency", elapsed)
+	}
+}
+
+func TestPluginReconnectsAfterDisconnect(t *testing.T) {
+	l, plugin := startLeader(t, bridgetest.Options{DropEvery: 2})
+	session := connectTools(t, l)
+
+	if text, isErr := callTool(t, session, "get_metadata", nil); isErr {
+		t.Fatalf("first get_metadata failed: %s", text)
+	}
+	// The second request drops the connection instead of being answered
+	if _, isErr := callTool(t, session, "get_metadata", nil); !isErr {
+		t.Fatal("get_metadata on a dropped connection succeeded")
+	}
+
+	waitPlugin(t, l, true)
+	text, isErr := callTool(t, session, "get_metadata", nil)
+	if isErr || !strings.Contains(text, `"fileName":"Simulator"`) {
+		t.Fatalf("get_metadata after reconnect = %s (error %v)", text, isErr)
+	}
+
+	plugin.Disconnect()
+	waitPlugin(t, l, false)
+	text, isErr = callTool(t, session, "get_metadata", nil)
+	if !isErr || !strings.Contains(text, "plugin not connected") {
+		t.Fatalf("get_metadata while disconnected = %q (error %v)", text, isErr)
+	}
+}
+
+func TestRecordedSessionReplays(t *testing.T) {
+	session := filepath.Join(t.TempDir(), "session.jsonl")
+	l, plugin := attachPlugin(t, runLeader(t, leader.Options{RecordFile: session}), bridgetest.Options{})
+	plugin.FailWith("get_styles", "styles are broken")
+
+	live := connectTools(t, l)
+	calls := []struct {
+		name string
+		args map[string]any
+	}{
+		{"get_selection", nil},
+		{"get_design_context", map[string]any{"depth": 1}},
+		{"get_node", map[string]any{"nodeId": "1:3"}},
+		{"get_styles", nil},
+	}
+	var want []string
+	for _, call := range calls {
+		text, _ := callTool(t, live, call.name, call.args)
+		want = append(want, text)
+	}
+	l.Stop()
+
+	exchanges, err := bridge.LoadSession(session)
+	if err != nil {
+		t.Fatalf("load session: %v", err)
+	}
+	if len(exchanges) != len(calls) || exchanges[3].Response == nil || exchanges[3].Response.Error != "styles are broken" {
+		t.Fatalf("recorded %+v", exchanges)
+	}
+
+	// No plugin this time: the answers come from the session
+	replayed := connectTools(t, runLeader(t, leader.Options{ReplayFile: session}))
+	for i, call := range calls {
+		if text, _ := callTool(t, replayed, call.name, call.args); text != want[i] {
+			t.Errorf("replayed %s = %s, want %s", call.name, text, want[i])
+		}
+	}
+	if text, isErr := callTool(t, replayed, "get_node", map[string]any{"nodeId": "1:4"}); !isErr || !strings.Contains(text, "no recorded answer") {
+		t.Errorf("get_node on an unrecorded node = %q (error %v)", text, isErr)
+	}
+}
+
+func TestProgressReachesClient(t *testing.T) {
+	l, _ := startLeader(t, bridgetest.Options{Latency: 60 * time.Millisecond})
+	progress := make(chan *mcp.ProgressNotificationParams, 10)
+	session := connectClient(t, newFollower(t, l), &mcp.ClientOptions{
+		ProgressNotificationHandler: func(_ context.Context, req *mcp.ProgressNotificationClientRequest) {
+			progress <- req.Params
+		},
+	})
+
+	// SetProgressToken loses the token when Meta is nil, so set Meta
+	params := &mcp.CallToolParams{
+		Meta:      mcp.Meta{"progressToken": "export-1"},
+		Name:      "get_screenshot",
+		Arguments: map[string]any{"nodeIds": []string{"1:3", "1:6"}},
+	}
+	result, err := session.CallTool(context.Background(), params)
+	if err != nil || result.IsError {
+		t.Fatalf("get_screenshot = %+v, %v", result, err)
+	}
+
+	for want := 1.0; want <= 2; want++ {
+		select {
+		case p := <-progress:
+			if p.ProgressToken != "export-1" || p.Progress != want || p.Total != 2 || p.Message == "" {
+				t.Fatalf("progress %v = %+v", want, p)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no progress notification %v", want)
+		}
+	}
+}
+
+// TestSlowProgressDoesNotHoldUpOtherCalls stalls the progress consumer of
+// an export. Progress is read off the same plugin connection and follower
+// link as every other answer, which must keep flowing.
+func TestSlowProgressDoesNotHoldUpOtherCalls(t *testing.T) {
+	l, _ := startLeader(t, bridgetest.Options{})
+	f := newFollower(t, l)
+
+	release := make(chan struct{})
+	stalled := make(chan struct{}, 1)
+	ctx := bridge.WithProgress(context.Background(), func(bridge.Progress) {
+		select {
+		case stalled <- struct{}{}:
+		default:
+		}
+		<-release
+	})
+	exported := make(chan error, 1)
+	go func() {
+		_, err := f.SendWithParams(ctx, "get_screenshot", []string{"1:3", "1:6"}, nil)
+		exported <- err
+	}()
+	select {
+	case <-stalled:
+	case <-time.After(5 * time.Second):
+		close(release)
+		t.Fatal("no progress reported")
+	}
+
+	callCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err := f.SendWithParams(callCtx, "get_metadata", nil, nil)
+	close(release)
+	if err != nil {
+		t.Fatalf("get_metadata behind a stalled progress consumer: %v", err)
+	}
+	if err := <-exported; err != nil {
+		t.Fatalf("get_screenshot: %v", err)
+	}
+}
+
+func TestTimeoutPerCall(t *testing.T) {
+	l, _ := startLeader(t, bridgetest.Options{Hang: []string{"get_styles"}})
+	session := connectTools(t, newFollower(t, l))
+
+	started := time.Now()
+	text, isErr := callTool(t, session, "get_styles", map[string]any{"timeout": 0.2})
+	if !isErr || !strings.Contains(text, "[timeout, retryable]") {
+		t.Fatalf("get_styles on a hung plugin = %q (error %v)", text, isErr)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("get_styles with a 0.2s timeout took %s", elapsed)
+	}
+	deadline := time.Now().Add(time.Second)
+	for l.Bridge().PendingCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("leader still waits for the plugin after the caller gave up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// postRPC sends body to the leader's /rpc and returns the status and body
+func postRPC(t *testing.T, l *leader.Leader, body string) (int, string) {
+	t.Helper()
+	return postRPCWithHeader(t, l, body, nil)
+}
+
+// postRPCWithHeader is postRPC sending extra headers
+func postRPCWithHeader(t *testing.T, l *leader.Leader, body string, header http.Header) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, config.BaseURL(l.Addr())+"/rpc", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("rpc: %v", err)
+	}
+	defer resp.Body.Close()
+	var out strings.Builder
+	if _, err := io.Copy(&out, resp.Body); err != nil {
+		t.Fatalf("rpc body: %v", err)
+	}
+	return resp.StatusCode, out.String()
+}
+
+func TestJSONRPC(t *testing.T) {
+	l, plugin := startLeader(t, bridgetest.Options{})
+
+	status, body := postRPC(t, l, `{"jsonrpc":"2.0","id":"a","method":"get_node","params":{"nodeId":"1:6"}}`)
+	var single leader.JSONRPCResponse
+	if err := json.Unmarshal([]byte(body), &single); err != nil || status != http.StatusOK {
+		t.Fatalf("get_node = %d %s", status, body)
+	}
+	if string(single.ID) != `"a"` || single.Error != nil || !strings.Contains(string(single.Result), `"name":"Logo"`) {
+		t.Fatalf("get_node = %s", body)
+	}
+
+	status, body = postRPC(t, l, `[
+		{"jsonrpc":"2.0","id":1,"method":"get_design_context","params":{"depth":1}},
+		{"jsonrpc":"2.0","method":"get_metadata"},
+		{"jsonrpc":"2.0","id":2,"method":"get_node","params":{"nodeId":"9:9"}},
+		{"jsonrpc":"2.0","id":3,"method":"delete_everything"},
+		{"jsonrpc":"2.0","id":4,"method":"get_node","params":["1:6"]},
+		{"id":5,"method":"get_styles"}
+	]`)
+	var batch []leader.JSONRPCResponse
+	if err := json.Unmarshal([]byte(body), &batch); err != nil || status != http.StatusOK || len(batch) != 5 {
+		t.Fatalf("batch = %d %s", status, body)
+	}
+	if batch[0].Error != nil || len(batch[0].Result) == 0 {
+		t.Fatalf("get_design_context in batch = %s", body)
+	}
+	wantErrors := []struct {
+		code     int
+		dataCode bridge.Code
+	}{
+		{leader.JSONRPCServerError, bridge.CodeNodeNotFound},
+		{leader.JSONRPCMethodNotFound, ""},
+		{leader.JSONRPCInvalidParams, ""},
+		{leader.JSONRPCInvalidRequest, ""},
+	}
+	for i, want := range wantErrors {
+		got := batch[i+1].Error
+		if got == nil || got.Code != want.code || (want.dataCode != "" && (got.Data == nil || got.Data.Code != want.dataCode)) {
+			t.Fatalf("batch[%d] = %s, want error %d %s", i+1, body, want.code, want.dataCode)
+		}
+	}
+
+	var ran bool
+	for _, req := range plugin.Requests() {
+		ran = ran || req.Type == "get_metadata"
+	}
+	if !ran {
+		t.Fatal("notification did not reach the plugin")
+	}
+
+	if status, body = postRPC(t, l, `{"jsonrpc":"2.0","method":"get_metadata"}`); status != http.StatusNoContent || body != "" {
+		t.Fatalf("notification = %d %q, want no content", status, body)
+	}
+	if _, body = postRPC(t, l, `{"jsonrpc":"2.0","id":1,"method":`); !strings.Contains(body, `"code":-32700`) || !strings.Contains(body, `"id":null`) {
+		t.Fatalf("malformed request = %s, want a parse error", body)
+	}
+	if _, body = postRPC(t, l, `{"tool":"get_node","nodeIds":["1:6"]}`); !strings.Contains(body, `"data":{`) || strings.Contains(body, "jsonrpc") {
+		t.Fatalf("original envelope = %s", body)
+	}
+}
+
+func TestJSONRPCLimits(t *testing.T) {
+	l, plugin := startLeader(t, bridgetest.Options{})
+
+	// Batch calls run a few at a time, so eight slow calls take two rounds
+	plugin.SetLatency(100 * time.Millisecond)
+	calls := make([]string, 8)
+	for i := range calls {
+		calls[i] = fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"get_metadata"}`, i)
+	}
+	started := time.Now()
+	status, body := postRPC(t, l, "["+strings.Join(calls, ",")+"]")
+	var batch []leader.JSONRPCResponse
+	if err := json.Unmarshal([]byte(body), &batch); err != nil || status != http.StatusOK || len(batch) != len(calls) {
+		t.Fatalf("batch = %d %s", status, body)
+	}
+	if elapsed := time.Since(started); elapsed < 200*time.Millisecond {
+		t.Fatalf("batch of %d took %s, want the calls limited to four at a time", len(calls), elapsed)
+	}
+	plugin.SetLatency(0)
+
+	calls = make([]string, 51)
+	for i := range calls {
+		calls[i] = `{"jsonrpc":"2.0","id":1,"method":"get_metadata"}`
+	}
+	status, body = postRPC(t, l, "["+strings.Join(calls, ",")+"]")
+	var single leader.JSONRPCResponse
+	if err := json.Unmarshal([]byte(body), &single); err != nil || status != http.StatusOK ||
+		single.Error == nil || single.Error.Code != leader.JSONRPCInvalidRequest {
+		t.Fatalf("batch of %d = %d %s, want an invalid request", len(calls), status, body)
+	}
+
+	padding := strings.Repeat(" ", 1<<20)
+	status, body = postRPC(t, l, `{"jsonrpc":"2.0","id":1,"method":"get_metadata"}`+padding)
+	single = leader.JSONRPCResponse{}
+	if err := json.Unmarshal([]byte(body), &single); err != nil || status != http.StatusRequestEntityTooLarge ||
+		single.Error == nil || single.Error.Code != leader.JSONRPCInvalidRequest {
+		t.Fatalf("oversized JSON-RPC body = %d %s, want 413 with an invalid request", status, body)
+	}
+	status, body = postRPC(t, l, `{"tool":"get_metadata"}`+padding)
+	var envelope leader.RPCResponse
+	if err := json.Unmarshal([]byte(body), &envelope); err != nil || status != http.StatusRequestEntityTooLarge ||
+		envelope.Code != bridge.CodeTooLarge {
+		t.Fatalf("oversized /rpc body = %d %s, want 413 with %s", status, body, bridge.CodeTooLarge)
+	}
+}
+
+// getAPI fetches path below the leader's REST API
+func getAPI(t *testing.T, l *leader.Leader, path string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, config.BaseURL(l.Addr())+leader.APIPrefix+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("GET %s body: %v", path, err)
+	}
+	return resp, body
+}
+
+func TestRESTAPI(t *testing.T) {
+	l, plugin := startLeader(t, bridgetest.Options{})
+
+	resp, body := getAPI(t, l, "selection")
+	var selection []map[string]any
+	if err := json.Unmarshal(body, &selection); err != nil || resp.StatusCode != http.StatusOK || len(selection) != 1 || selection[0]["id"] != "1:2" {
+		t.Fatalf("selection = %d %s", resp.StatusCode, body)
+	}
+
+	resp, body = getAPI(t, l, "nodes/1:6")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"name":"Logo"`) {
+		t.Fatalf("node = %d %s", resp.StatusCode, body)
+	}
+
+	resp, body = getAPI(t, l, "nodes/1:6/export?format=png&scale=3")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/png" || !strings.HasPrefix(string(body), "\x89PNG") {
+		t.Fatalf("export = %d %s %q", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+	requests := plugin.Requests()
+	last := requests[len(requests)-1]
+	if last.Type != "get_screenshot" || last.Params["format"] != "PNG" || last.Params["scale"] != 3.0 {
+		t.Fatalf("export asked the plugin for %+v", last)
+	}
+
+	resp, body = getAPI(t, l, "variables")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("variables = %d %s", resp.StatusCode, body)
+	}
+
+	resp, body = getAPI(t, l, "nodes/9:9")
+	var apiErr leader.APIError
+	if err := json.Unmarshal(body, &apiErr); err != nil || resp.StatusCode != http.StatusNotFound || apiErr.Error.Code != bridge.CodeNodeNotFound || apiErr.Error.Retryable {
+		t.Fatalf("missing node = %d %s", resp.StatusCode, body)
+	}
+	resp, body = getAPI(t, l, "nodes/1:6/export?format=gif")
+	apiErr = leader.APIError{}
+	if err := json.Unmarshal(body, &apiErr); err != nil || resp.StatusCode != http.StatusBadRequest || apiErr.Error.Code != bridge.CodeBadRequest {
+		t.Fatalf("gif export = %d %s", resp.StatusCode, body)
+	}
+	resp, body = getAPI(t, l, "frames")
+	apiErr = leader.APIError{}
+	if err := json.Unmarshal(body, &apiErr); err != nil || resp.StatusCode != http.StatusNotFound ||
+		resp.Header.Get("Content-Type") != "application/json" || apiErr.Error.Code != bridge.CodeNotFound {
+		t.Fatalf("unknown route = %d %s, want a JSON 404", resp.StatusCode, body)
+	}
+
+	// The API description needs no token
+	resp, err := http.Get(config.BaseURL(l.Addr()) + leader.APIPrefix + "openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		OpenAPI string         `json:"openapi"`
+		Paths   map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil || doc.OpenAPI == "" || doc.Paths["/nodes/{id}/export"] == nil {
+		t.Fatalf("openapi.json = %d %+v %v", resp.StatusCode, doc, err)
+	}
+	if !strings.Contains(string(raw), `"`+string(bridge.CodeBadRequest)+`"`) {
+		t.Fatalf("openapi.json does not list %s", bridge.CodeBadRequest)
+	}
+}
+
+// freeAddr returns a loopback address nothing listens on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestEmbeddedServerAndClient(t *testing.T) {
+	dir := t.TempDir()
+	addr := freeAddr(t)
+	srv, err := figmabridge.NewServer(
+		figmabridge.WithAddr(addr),
+		figmabridge.WithRole(figmabridge.RoleLeader),
+		figmabridge.WithToken(testToken),
+		figmabridge.WithStateDir(filepath.Join(dir, "run")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Stop)
+	if srv.Role() != figmabridge.RoleLeader {
+		t.Fatalf("role = %s", srv.Role())
+	}
+
+	client, err := figmabridge.NewClient(figmabridge.WithLeaderURL(config.BaseURL(addr)), figmabridge.WithToken(testToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	events, err := client.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func(want string, connected bool) figmabridge.Event {
+		t.Helper()
+		for {
+			select {
+			case event := <-events:
+				if event.Type == want && event.Connected == connected {
+					return event
+				}
+			case <-ctx.Done():
+				t.Fatalf("no %s event with connected %v", want, connected)
+			}
+		}
+	}
+	if event := next(figmabridge.EventLeader, false); event.Epoch == 0 {
+		t.Fatalf("leader event without epoch: %+v", event)
+	}
+
+	plugin := bridgetest.New(nil, bridgetest.Options{ReconnectDelay: 20 * time.Millisecond})
+	go plugin.Run(ctx, "ws://"+addr+"/ws")
+	next(figmabridge.EventPlugin, true)
+
+	selection, err := client.Selection(ctx)
+	if err != nil || len(selection) != 1 || selection[0].ID != "1:2" || selection[0].Name != "Card" || len(selection[0].Children) != 2 {
+		t.Fatalf("selection = %+v, %v", selection, err)
+	}
+	if len(selection[0].Raw) == 0 {
+		t.Fatal("selection node has no raw JSON")
+	}
+
+	title, err := client.Node(ctx, "1:3")
+	if err != nil || title.Type != "TEXT" || title.Characters != "Hello, Figma" {
+		t.Fatalf("node = %+v, %v", title, err)
+	}
+	if title.Bounds == nil || *title.Bounds != (figmabridge.Bounds{X: 16, Y: 16, Width: 120, Height: 24}) || title.Styles["fontFamily"] != "Inter" {
+		t.Fatalf("node bounds %+v and styles %v, want the fixture's", title.Bounds, title.Styles)
+	}
+	_, err = client.Node(ctx, "9:9")
+	var notFound *figmabridge.Error
+	if !errors.As(err, &notFound) || notFound.Code != figmabridge.CodeNodeNotFound || notFound.Retryable || notFound.Hint == "" {
+		t.Fatalf("missing node error = %#v", err)
+	}
+	status, err := client.Status(ctx)
+	if err != nil || status.Leader.Epoch == 0 || status.Leader.Addr != addr || !status.Plugin.Connected {
+		t.Fatalf("status = %+v, %v", status, err)
+	}
+
+	var progress []figmabridge.Progress
+	export, err := client.Export(ctx, "1:6", figmabridge.ExportOptions{
+		Scale:      3,
+		OnProgress: func(p figmabridge.Progress) { progress = append(progress, p) },
+	})
+	if err != nil || export.NodeID != "1:6" || export.Format != figmabridge.FormatPNG || export.Width != 48 || !strings.HasPrefix(string(export.Data), "\x89PNG") {
+		t.Fatalf("export = %+v, %v", export, err)
+	}
+	if len(progress) != 1 || progress[0].Total != 1 {
+		t.Fatalf("export progress = %+v", progress)
+	}
+	requests := plugin.Requests()
+	if last := requests[len(requests)-1]; last.Params["scale"] != 3.0 {
+		t.Fatalf("export asked the plugin for %+v", last)
+	}
+
+	plugin.Disconnect()
+	next(figmabridge.EventPlugin, false)
+}
+
+func TestSessionsExpireWithoutDelete(t *testing.T) {
+	sessions := mcpbridge.NewSessions()
+	server := mcp.NewServer(&mcp.Implementation{Name: "figma-bridge", Version: leader.Version}, nil)
+	server.AddReceivingMiddleware(sessions.Middleware())
+	ts := httptest.NewServer(mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, nil))
+	t.Cleanup(ts.Close)
+
+	// A client that goes away without closing its session never sends the
+	// DELETE that would end it
+	client := mcp.NewClient(&mcp.Implementation{Name: "vanishing"}, nil)
+	if _, err := client.Connect(context.Background(), &mcp.StreamableClientTransport{Endpoint: ts.URL}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if sessions.Len() != 1 || sessions.Idle() != 0 {
+		t.Fatalf("after connect: %d sessions, idle %s", sessions.Len(), sessions.Idle())
+	}
+
+	if n := sessions.Expire(time.Hour); n != 0 {
+		t.Fatalf("expired %d fresh sessions", n)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := sessions.Expire(10 * time.Millisecond); n != 1 {
+		t.Fatalf("expired %d sessions, want 1", n)
+	}
+	if sessions.Len() != 0 {
+		t.Fatalf("%d sessions left after expiry", sessions.Len())
+	}
+	time.Sleep(20 * time.Millisecond)
+	if idle := sessions.Idle(); idle < 10*time.Millisecond {
+		t.Fatalf("idle = %s after the last session expired", idle)
+	}
+}
+
+func TestEpochFence(t *testing.T) {
+	dir := t.TempDir()
+	epochFile := filepath.Join(dir, "epoch")
+	l := leader.New("127.0.0.1:0", leader.Options{
+		Token:          testToken,
+		AllowedOrigins: []string{"https://www.figma.com"},
+		EpochFile:      epochFile,
+		LockFile:       filepath.Join(dir, "run", "leader.lock"),
+	})
+	if err := l.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(l.Stop)
+	attachPlugin(t, l, bridgetest.Options{})
+
+	epoch := strconv.FormatUint(l.Identity().Epoch, 10)
+	stale := strconv.FormatUint(l.Identity().Epoch-1, 10)
+	const body = `{"tool":"get_metadata"}`
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		// Scripts have no epoch to send; they are the one legacy exception
+		{"script without headers", nil, http.StatusOK},
+		{"node with current epoch", http.Header{leader.NodeHeader: {"n1"}, leader.EpochHeader: {epoch}}, http.StatusOK},
+		{"node without epoch", http.Header{leader.NodeHeader: {"n1"}}, http.StatusConflict},
+		{"node with older epoch", http.Header{leader.NodeHeader: {"n1"}, leader.EpochHeader: {stale}}, http.StatusConflict},
+		{"script with older epoch", http.Header{leader.EpochHeader: {stale}}, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		if status, out := postRPCWithHeader(t, l, body, tt.header); status != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, status, tt.status, out)
+		}
+	}
+
+	// A follower whose link opened before the takeover
+	f := newFollower(t, l)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, linkDone, err := f.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Once a newer leader took the epoch, nobody gets through
+	next := strconv.FormatUint(l.Identity().Epoch+1, 10)
+	if err := os.WriteFile(epochFile, []byte(next), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// The open link is refused per request, as safe to resend, and closed
+	if _, err := f.Send(ctx, "get_metadata", nil); !errors.Is(err, follower.ErrLeaderUnavailable) || !strings.Contains(err.Error(), "superseded") {
+		t.Fatalf("superseded leader answered over an open link: %v", err)
+	}
+	select {
+	case <-linkDone:
+	case <-ctx.Done():
+		t.Fatal("superseded leader kept the link open")
+	}
+	if status, out := postRPC(t, l, body); status != http.StatusConflict || !strings.Contains(out, "superseded") {
+		t.Fatalf("superseded leader answered a script: %d %s", status, out)
+	}
+	if status, _ := postRPC(t, l, `{"jsonrpc":"2.0","id":1,"method":"get_metadata"}`); status != http.StatusConflict {
+		t.Fatalf("superseded leader answered JSON-RPC: %d", status)
+	}
+	if resp, body := getAPI(t, l, "selection"); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("superseded leader answered REST: %d %s", resp.StatusCode, body)
+	}
+}
+
+// TestHandoffOverLink registers followers and announces the handoff on the
+// link alone: the longest-linked follower is named successor.
+func TestHandoffOverLink(t *testing.T) {
+	l, stop := runStoppableLeader(t, leader.Options{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	followers := linkFollowers(t, ctx, l, "first", "second")
+	if first := l.ClusterStatus().Followers[0]; first.ID != "first" || first.Client != "first-client" {
+		t.Fatalf("oldest follower = %+v, want first with its client", first)
+	}
+	events := watchHandoff(t, ctx, followers)
+	stop()
+
+	for range followers {
+		if event := <-events; event.Event != leader.EventShutdown || event.Successor != "first" {
+			t.Fatalf("handoff = %+v, want shutdown naming first", event)
+		}
+	}
+}
+
+// TestNewerNodeTakesOver asks a leader to hand over as nodes running other
+// versions. Only a newer one that its followers can still talk to is let
+// in, and it becomes successor ahead of older followers.
+func TestNewerNodeTakesOver(t *testing.T) {
+	var stop func()
+	stepDowns := make(chan struct{}, 1)
+	l, stop := runStoppableLeader(t, leader.Options{StepDown: func() {
+		stepDowns <- struct{}{}
+		stop()
+	}})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	followers := linkFollowers(t, ctx, l, "old", "newer")
+
+	takeover := func(version string, protocol, minProtocol int) error {
+		return leader.RequestTakeover(ctx, http.DefaultClient, config.BaseURL(l.Addr()), testToken, leader.TakeoverRequest{
+			ID:          "newer",
+			Version:     version,
+			Protocol:    protocol,
+			MinProtocol: minProtocol,
+		})
+	}
+	if err := takeover(leader.Version, leader.Protocol, leader.MinProtocol); err == nil {
+		t.Fatal("leader handed over to its own version")
+	}
+	if err := takeover("0.0.1", leader.Protocol, leader.MinProtocol); err == nil {
+		t.Fatal("leader handed over to an older version")
+	}
+	if err := takeover("99.0.0", leader.Protocol+2, leader.Protocol+1); err == nil {
+		t.Fatal("leader handed over to a version its followers cannot talk to")
+	}
+	select {
+	case <-stepDowns:
+		t.Fatal("leader stepped down for a refused takeover")
+	default:
+	}
+
+	events := watchHandoff(t, ctx, followers)
+	if err := takeover("99.0.0", leader.Protocol, leader.MinProtocol); err != nil {
+		t.Fatalf("newer compatible version refused: %v", err)
+	}
+	select {
+	case <-stepDowns:
+	case <-ctx.Done():
+		t.Fatal("leader did not step down")
+	}
+	for range followers {
+		if event := <-events; event.Event != leader.EventShutdown || event.Successor != "newer" {
+			t.Fatalf("handoff = %+v, want shutdown naming the newer node", event)
+		}
+	}
+}
+
+// linkFollowers links a follower per id to l, in order, and waits until the
+// leader has registered them all
+func linkFollowers(t *testing.T, ctx context.Context, l *leader.Leader, ids ...string) []*follower.Follower {
+	t.Helper()
+	locator := discovery.Locator{URL: config.BaseURL(l.Addr()), Token: testToken}
+	var followers []*follower.Follower
+	for _, id := range ids {
+		f := follower.New(locator, id)
+		t.Cleanup(f.Close)
+		// Heartbeats go on the link, opening it
+		if err := f.Heartbeat(ctx, id+"-client"); err != nil {
+			t.Fatal(err)
+		}
+		followers = append(followers, f)
+	}
+	for len(l.ClusterStatus().Followers) < len(ids) {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("followers not registered: %+v", l.ClusterStatus().Followers)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return followers
+}
+
+// watchHandoff watches for the leader's handoff on each follower's link
+func watchHandoff(t *testing.T, ctx context.Context, followers []*follower.Follower) <-chan leader.WatchEvent {
+	t.Helper()
+	events := make(chan leader.WatchEvent, len(followers))
+	for _, f := range followers {
+		go func() {
+			event, err := f.Watch(ctx)
+			if err != nil {
+				t.Errorf("watch: %v", err)
+			}
+			events <- event
+		}()
+	}
+	// Watch subscribes before it waits; give every follower a moment
+	time.Sleep(50 * time.Millisecond)
+	return events
+}
+
+// TestRelay serves the plugin through a relay on a second listener. Relayed
+// requests are recorded like direct ones, and followers see one plugin
+// state: a direct plugin leaving does not hide the relay's.
+func TestRelay(t *testing.T) {
+	session := filepath.Join(t.TempDir(), "session.jsonl")
+	l := runLeader(t, leader.Options{RecordFile: session})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	f := newFollower(t, l)
+	events, unsubscribe := f.Subscribe()
+	defer unsubscribe()
+	if _, _, err := f.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	addr := freeAddr(t)
+	rb := bridge.NewBridge(addr)
+	relaySession := filepath.Join(t.TempDir(), "relay.jsonl")
+	if err := rb.Record(relaySession); err != nil {
+		t.Fatal(err)
+	}
+	go rb.Start()
+	t.Cleanup(func() { rb.Stop() })
+	go relay.NewClient(config.BaseURL(l.Addr()), testToken, rb, nil).Run(ctx)
+
+	relayed := bridgetest.New(nil, bridgetest.Options{})
+	for relayed.Connect(ctx, "ws://"+addr+"/ws") != nil {
+		select {
+		case <-ctx.Done():
+			t.Fatal("relay never served the plugin")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	var got []bool
+	nextPlugin := func() bool {
+		t.Helper()
+		for {
+			select {
+			case msg := <-events:
+				var event link.PluginEvent
+				if msg.Event == link.EventPlugin && json.Unmarshal(msg.Data, &event) == nil {
+					got = append(got, event.Connected)
+					return event.Connected
+				}
+			case <-ctx.Done():
+				t.Fatalf("no plugin event after %v", got)
+			}
+		}
+	}
+	if !nextPlugin() {
+		t.Fatal("relayed plugin reported as disconnected")
+	}
+
+	session1 := connectTools(t, l)
+	if text, isErr := callTool(t, session1, "get_selection", nil); isErr {
+		t.Fatalf("get_selection through the relay: %s", text)
+	}
+	if n := len(relayed.Requests()); n != 1 {
+		t.Fatalf("relayed plugin got %d requests, want 1", n)
+	}
+
+	// A direct plugin comes and goes while the relay keeps its own
+	direct := bridgetest.New(nil, bridgetest.Options{})
+	if err := direct.Connect(ctx, wsURL(l)); err != nil {
+		t.Fatal(err)
+	}
+	waitPlugin(t, l, true)
+	direct.Disconnect()
+	waitPlugin(t, l, false)
+	if text, isErr := callTool(t, session1, "get_selection", nil); isErr {
+		t.Fatalf("get_selection after the direct plugin left: %s", text)
+	}
+
+	relayed.Disconnect()
+	if nextPlugin() {
+		t.Fatalf("plugin events %v, want [true false]", got)
+	}
+	if len(got) != 2 {
+		t.Fatalf("plugin events %v, want [true false]", got)
+	}
+
+	// Both the leader and the relay record the calls the relay served
+	l.Bridge().StopRecording()
+	rb.StopRecording()
+	for _, path := range []string{session, relaySession} {
+		exchanges, err := bridge.LoadSession(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var answered int
+		for _, ex := range exchanges {
+			if ex.Request.Type == "get_selection" && ex.Response != nil && ex.Response.Error == "" {
+				answered++
+			}
+		}
+		if answered != 2 {
+			t.Fatalf("%s has %d answered get_selection exchanges, want 2 from the relay: %+v", filepath.Base(path), answered, exchanges)
+		}
+	}
+}
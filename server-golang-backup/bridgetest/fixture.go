@@ -0,0 +1,105 @@
+package bridgetest
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+//go:embed fixtures/default.json
+var defaultFixture []byte
+
+// placeholderPNG is a 1x1 transparent PNG returned for nodes without a
+// screenshot in the fixture
+const placeholderPNG = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg=="
+
+// Fixture is the Figma document the simulator serves. Nodes are plain JSON
+// objects in the shape of the plugin's serializeNode: id, name, type,
+// bounds {x, y, width, height}, styles {fills, strokes, cornerRadius,
+// padding, and fontSize etc. for TEXT}, characters for TEXT and children.
+// Only id, bounds and children mean something to the simulator.
+type Fixture struct {
+	FileName string                 `json:"fileName"`
+	Page     map[string]interface{} `json:"page"`
+	Pages    []map[string]string    `json:"pages,omitempty"`
+	// Selection lists the IDs of the selected nodes on Page
+	Selection []string `json:"selection,omitempty"`
+	// Styles and Variables are returned as is by get_styles and
+	// get_variable_defs
+	Styles    json.RawMessage `json:"styles,omitempty"`
+	Variables json.RawMessage `json:"variables,omitempty"`
+	// Screenshots maps node IDs to base64 images returned by get_screenshot
+	Screenshots map[string]string `json:"screenshots,omitempty"`
+
+	nodes map[string]map[string]interface{}
+}
+
+// DefaultFixture returns a small built-in document: a card frame with text
+// and an instance, a logo, two pages, styles and a variable collection
+func DefaultFixture() *Fixture {
+	f, err := ParseFixture(defaultFixture)
+	if err != nil {
+		panic("bridgetest: invalid default fixture: " + err.Error())
+	}
+	return f
+}
+
+// LoadFixture reads a fixture from a JSON file
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := ParseFixture(data)
+	if err != nil {
+		return nil, fmt.Errorf("fixture %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// ParseFixture decodes a fixture and indexes its nodes
+func ParseFixture(data []byte) (*Fixture, error) {
+	var f Fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	if f.Page == nil {
+		return nil, fmt.Errorf("missing page")
+	}
+	f.nodes = make(map[string]map[string]interface{})
+	f.index(f.Page)
+	for _, id := range f.Selection {
+		if _, ok := f.nodes[id]; !ok {
+			return nil, fmt.Errorf("selected node %s is not on the page", id)
+		}
+	}
+	return &f, nil
+}
+
+func (f *Fixture) index(node map[string]interface{}) {
+	if id, ok := node["id"].(string); ok {
+		f.nodes[id] = node
+	}
+	for _, child := range children(node) {
+		f.index(child)
+	}
+}
+
+// Node returns the node with the given ID, if it is on the page and not
+// the page itself
+func (f *Fixture) Node(id string) (map[string]interface{}, bool) {
+	node, ok := f.nodes[id]
+	return node, ok && node["type"] != "PAGE"
+}
+
+func children(node map[string]interface{}) []map[string]interface{} {
+	list, _ := node["children"].([]interface{})
+	out := make([]map[string]interface{}, 0, len(list))
+	for _, child := range list {
+		if m, ok := child.(map[string]interface{}); ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
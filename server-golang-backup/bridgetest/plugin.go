@@ -0,0 +1,250 @@
+// Package bridgetest simulates the Figma plugin so the bridge can be tested
+// without Figma. A Plugin connects to a leader's /ws like the real one and
+// answers requests from a Fixture, optionally with injected latency, errors,
+// hangs and disconnects.
+package bridgetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"figma-mcp-bridge-v2/bridge"
+)
+
+// Options configures the faults a Plugin injects
+type Options struct {
+	// Origin is sent on the WebSocket handshake; default https://www.figma.com
+	Origin string
+	// Latency delays every response
+	Latency time.Duration
+	// Errors maps request types to errors returned instead of data
+	Errors map[string]string
+	// Hang lists request types that are never answered
+	Hang []string
+	// DropEvery closes the connection instead of answering every Nth request
+	DropEvery int
+	// ReconnectDelay is how long Run waits before reconnecting; default 500ms
+	ReconnectDelay time.Duration
+	// Logf, if set, is called for every request and connection change
+	Logf func(format string, args ...interface{})
+}
+
+// Plugin is a simulated Figma plugin
+type Plugin struct {
+	fixture *Fixture
+
+	mu       sync.Mutex
+	opts     Options
+	conn     *websocket.Conn
+	requests []bridge.Request
+
+	writeMu sync.Mutex
+}
+
+// New creates a plugin serving f. A nil f serves DefaultFixture.
+func New(f *Fixture, opts Options) *Plugin {
+	if f == nil {
+		f = DefaultFixture()
+	}
+	if opts.Origin == "" {
+		opts.Origin = "https://www.figma.com"
+	}
+	if opts.ReconnectDelay == 0 {
+		opts.ReconnectDelay = 500 * time.Millisecond
+	}
+	if opts.Errors == nil {
+		opts.Errors = make(map[string]string)
+	}
+	return &Plugin{fixture: f, opts: opts}
+}
+
+// SetLatency changes the delay before every response
+func (p *Plugin) SetLatency(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.opts.Latency = d
+}
+
+// FailWith makes requests of the given type fail with message; an empty
+// message makes them succeed again
+func (p *Plugin) FailWith(requestType, message string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if message == "" {
+		delete(p.opts.Errors, requestType)
+	} else {
+		p.opts.Errors[requestType] = message
+	}
+}
+
+// Requests returns every request received so far
+func (p *Plugin) Requests() []bridge.Request {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.requests)
+}
+
+// Connected reports whether the plugin has an open connection
+func (p *Plugin) Connected() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.conn != nil
+}
+
+// Connect dials the bridge at wsURL and serves it in the background until
+// the connection drops. Use Run to reconnect like the real plugin.
+func (p *Plugin) Connect(ctx context.Context, wsURL string) error {
+	conn, err := p.dial(ctx, wsURL)
+	if err != nil {
+		return err
+	}
+	go p.serve(conn)
+	return nil
+}
+
+// Run keeps the plugin connected to wsURL until ctx ends, reconnecting after
+// every disconnect
+func (p *Plugin) Run(ctx context.Context, wsURL string) error {
+	for {
+		conn, err := p.dial(ctx, wsURL)
+		if err == nil {
+			stop := context.AfterFunc(ctx, func() { conn.Close() })
+			p.serve(conn)
+			stop()
+		} else if ctx.Err() == nil {
+			p.logf("Connect failed: %v", err)
+		}
+
+		p.mu.Lock()
+		delay := p.opts.ReconnectDelay
+		p.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Disconnect drops the current connection without a close frame, like a
+// closed Figma tab
+func (p *Plugin) Disconnect() {
+	p.mu.Lock()
+	conn := p.conn
+	p.mu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+func (p *Plugin) dial(ctx context.Context, wsURL string) (*websocket.Conn, error) {
+	p.mu.Lock()
+	header := http.Header{"Origin": {p.opts.Origin}}
+	p.mu.Unlock()
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, header)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.conn = conn
+	p.mu.Unlock()
+	p.logf("Connected to %s", wsURL)
+	return conn, nil
+}
+
+func (p *Plugin) serve(conn *websocket.Conn) {
+	defer func() {
+		conn.Close()
+		p.mu.Lock()
+		if p.conn == conn {
+			p.conn = nil
+		}
+		p.mu.Unlock()
+		p.logf("Disconnected")
+	}()
+
+	for {
+		_, payload, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req bridge.Request
+		if err := json.Unmarshal(payload, &req); err != nil {
+			p.logf("Invalid request: %v", err)
+			continue
+		}
+
+		p.mu.Lock()
+		p.requests = append(p.requests, req)
+		count := len(p.requests)
+		opts := p.opts
+		failure := opts.Errors[req.Type]
+		p.mu.Unlock()
+		p.logf("%s %s %v", req.RequestID, req.Type, req.NodeIDs)
+
+		switch {
+		case opts.DropEvery > 0 && count%opts.DropEvery == 0:
+			p.logf("Dropping connection on %s", req.RequestID)
+			return
+		case slices.Contains(opts.Hang, req.Type):
+			continue
+		}
+
+		go func() {
+			p.work(conn, req, opts.Latency)
+			resp := p.fixture.Respond(req)
+			if failure != "" {
+				resp.Data, resp.Error = nil, failure
+			}
+			if err := p.write(conn, resp); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+				p.logf("Reply to %s failed: %v", req.RequestID, err)
+			}
+		}()
+	}
+}
+
+// work waits out the injected latency. Like the real plugin, exports
+// report progress after each node, with the latency spread over them.
+func (p *Plugin) work(conn *websocket.Conn, req bridge.Request, latency time.Duration) {
+	total := len(req.NodeIDs)
+	if total == 0 {
+		total = len(p.fixture.Selection)
+	}
+	if req.Type != "get_screenshot" || total == 0 {
+		time.Sleep(latency)
+		return
+	}
+	for i := 1; i <= total; i++ {
+		time.Sleep(latency / time.Duration(total))
+		_ = p.write(conn, bridge.ProgressMessage{
+			Type:      bridge.TypeProgress,
+			RequestID: req.RequestID,
+			Progress: bridge.Progress{
+				Progress: float64(i),
+				Total:    float64(total),
+				Message:  fmt.Sprintf("Exported %d of %d nodes", i, total),
+			},
+		})
+	}
+}
+
+func (p *Plugin) write(conn *websocket.Conn, msg interface{}) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	return conn.WriteJSON(msg)
+}
+
+func (p *Plugin) logf(format string, args ...interface{}) {
+	if p.opts.Logf != nil {
+		p.opts.Logf(format, args...)
+	}
+}
@@ -0,0 +1,157 @@
+package bridgetest
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"figma-mcp-bridge-v2/bridge"
+)
+
+// Respond answers a request from the fixture the way the Figma plugin
+// would, without any injected faults
+func (f *Fixture) Respond(req bridge.Request) bridge.Response {
+	data, err := f.handle(req)
+	resp := bridge.Response{Type: req.Type, RequestID: req.RequestID}
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Data = data
+	}
+	return resp
+}
+
+func (f *Fixture) handle(req bridge.Request) (interface{}, error) {
+	switch req.Type {
+	case "get_document":
+		return f.Page, nil
+	case "get_selection":
+		return f.selected(), nil
+	case "get_node":
+		if len(req.NodeIDs) == 0 {
+			return nil, fmt.Errorf("nodeIds is required for get_node")
+		}
+		// Unlike the other requests, the plugin serves pages here
+		node, ok := f.nodes[req.NodeIDs[0]]
+		if !ok {
+			return nil, fmt.Errorf("Node not found: %s", req.NodeIDs[0])
+		}
+		return node, nil
+	case "get_styles":
+		return rawOr(f.Styles, `{"paints":[],"text":[],"effects":[],"grids":[]}`), nil
+	case "get_metadata":
+		return map[string]interface{}{
+			"fileName":        f.FileName,
+			"currentPageId":   f.Page["id"],
+			"currentPageName": f.Page["name"],
+			"pageCount":       len(f.Pages),
+			"pages":           f.Pages,
+		}, nil
+	case "get_design_context":
+		depth := 2
+		if d, ok := req.Params["depth"].(float64); ok {
+			depth = int(d)
+		}
+		selection := f.selected()
+		contextNodes := make([]map[string]interface{}, 0, len(selection))
+		if len(selection) == 0 {
+			selection = []map[string]interface{}{f.Page}
+		}
+		for _, node := range selection {
+			contextNodes = append(contextNodes, withDepth(node, depth, 0))
+		}
+		return map[string]interface{}{
+			"fileName":       f.FileName,
+			"currentPage":    map[string]interface{}{"id": f.Page["id"], "name": f.Page["name"]},
+			"selectionCount": len(f.Selection),
+			"context":        contextNodes,
+		}, nil
+	case "get_variable_defs":
+		return rawOr(f.Variables, `{"collections":[]}`), nil
+	case "get_screenshot":
+		return f.screenshot(req)
+	default:
+		return nil, fmt.Errorf("Unknown request type: %s", req.Type)
+	}
+}
+
+func (f *Fixture) selected() []map[string]interface{} {
+	nodes := make([]map[string]interface{}, 0, len(f.Selection))
+	for _, id := range f.Selection {
+		if node, ok := f.Node(id); ok {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+func (f *Fixture) screenshot(req bridge.Request) (interface{}, error) {
+	format, _ := req.Params["format"].(string)
+	if format == "" {
+		format = "PNG"
+	}
+
+	var targets []map[string]interface{}
+	if len(req.NodeIDs) > 0 {
+		for _, id := range req.NodeIDs {
+			if node, ok := f.Node(id); ok {
+				targets = append(targets, node)
+			}
+		}
+	} else {
+		targets = f.selected()
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("No nodes to export. Select nodes or provide nodeIds.")
+	}
+
+	exports := make([]map[string]interface{}, 0, len(targets))
+	for _, node := range targets {
+		id, _ := node["id"].(string)
+		image, ok := f.Screenshots[id]
+		if !ok {
+			image = placeholderPNG
+		}
+		bounds, _ := node["bounds"].(map[string]interface{})
+		exports = append(exports, map[string]interface{}{
+			"nodeId":   id,
+			"nodeName": node["name"],
+			"format":   format,
+			"base64":   image,
+			"width":    bounds["width"],
+			"height":   bounds["height"],
+		})
+	}
+	return map[string]interface{}{"exports": exports}, nil
+}
+
+// withDepth copies node, replacing children below depth by a childCount
+// like the plugin's get_design_context. As there, a node with an empty
+// children list gets a childCount of 0; one without the field gets none.
+func withDepth(node map[string]interface{}, depth, current int) map[string]interface{} {
+	out := make(map[string]interface{}, len(node))
+	for k, v := range node {
+		out[k] = v
+	}
+	if _, ok := node["children"]; !ok {
+		return out
+	}
+	kids := children(node)
+	if current >= depth {
+		delete(out, "children")
+		out["childCount"] = len(kids)
+		return out
+	}
+	list := make([]interface{}, 0, len(kids))
+	for _, child := range kids {
+		list = append(list, withDepth(child, depth, current+1))
+	}
+	out["children"] = list
+	return out
+}
+
+func rawOr(raw json.RawMessage, fallback string) json.RawMessage {
+	if len(raw) == 0 {
+		return json.RawMessage(fallback)
+	}
+	return raw
+}
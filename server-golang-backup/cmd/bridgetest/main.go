@@ -0,0 +1,57 @@
+// Command bridgetest connects a simulated Figma plugin to a running bridge,
+// so MCP clients can be tried without Figma.
+//
+// Usage:
+//
+//	bridgetest [-url ws://127.0.0.1:1994/ws] [-fixture doc.json] [-latency 200ms]
+//	           [-error get_node="Node not found: 1:2"] [-hang get_screenshot] [-drop-every 5]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"figma-mcp-bridge-v2/bridgetest"
+	"figma-mcp-bridge-v2/config"
+)
+
+func main() {
+	url := flag.String("url", "ws"+strings.TrimPrefix(config.BaseURL(config.DefaultAddr), "http")+"/ws", "bridge WebSocket URL")
+	fixture := flag.String("fixture", "", "JSON fixture document (default: built-in sample)")
+	opts := bridgetest.Options{Errors: make(map[string]string), Logf: log.Printf}
+	flag.DurationVar(&opts.Latency, "latency", 0, "delay before every response")
+	flag.IntVar(&opts.DropEvery, "drop-every", 0, "drop the connection instead of answering every Nth request")
+	flag.StringVar(&opts.Origin, "origin", "", "Origin header (default https://www.figma.com)")
+	flag.Func("error", "make a request type fail, as type=message (repeatable)", func(v string) error {
+		requestType, message, ok := strings.Cut(v, "=")
+		if !ok || requestType == "" || message == "" {
+			return fmt.Errorf("want type=message")
+		}
+		opts.Errors[requestType] = message
+		return nil
+	})
+	flag.Func("hang", "never answer this request type (repeatable)", func(v string) error {
+		opts.Hang = append(opts.Hang, v)
+		return nil
+	})
+	flag.Parse()
+
+	f := bridgetest.DefaultFixture()
+	if *fixture != "" {
+		var err error
+		if f, err = bridgetest.LoadFixture(*fixture); err != nil {
+			log.Fatalf("Cannot load fixture: %v", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Simulating the Figma plugin for %q on %s", f.FileName, *url)
+	bridgetest.New(f, opts).Run(ctx, *url)
+}
@@ -0,0 +1,528 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"figma-mcp-bridge-v2/auth"
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/discovery"
+)
+
+// DefaultAddr is the listen address used when nothing else is configured.
+// The bridge serves unreleased designs, so it only listens on loopback
+// unless told otherwise.
+const DefaultAddr = "127.0.0.1:1994"
+
+// Environment variables read by Load. They override the config file and are
+// overridden by command line flags.
+const (
+	EnvConfig    = "FIGMA_BRIDGE_CONFIG"
+	EnvProfile   = "FIGMA_BRIDGE_PROFILE"
+	EnvAddr      = "FIGMA_BRIDGE_ADDR"
+	EnvPort      = "FIGMA_BRIDGE_PORT"
+	EnvLeaderURL = "FIGMA_BRIDGE_LEADER_URL"
+	EnvToken     = "FIGMA_BRIDGE_TOKEN"
+	EnvTokenFile = "FIGMA_BRIDGE_TOKEN_FILE"
+	EnvOrigins   = "FIGMA_BRIDGE_ALLOWED_ORIGINS"
+	EnvAllowNull = "FIGMA_BRIDGE_ALLOW_NULL_ORIGIN"
+	EnvRole      = "FIGMA_BRIDGE_ROLE"
+	EnvRecord    = "FIGMA_BRIDGE_RECORD"
+	EnvReplay    = "FIGMA_BRIDGE_REPLAY"
+	EnvTraceFile = "FIGMA_BRIDGE_TRACE_FILE"
+	EnvTimeouts  = "FIGMA_BRIDGE_TIMEOUTS"
+	// EnvTraceEndpoint falls back to the standard OpenTelemetry variable
+	EnvTraceEndpoint = "FIGMA_BRIDGE_TRACE_ENDPOINT"
+	envOTLPEndpoint  = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+)
+
+// Roles a node can be started in
+const (
+	// RoleAuto takes part in the election
+	RoleAuto = "auto"
+	// RoleLeader always leads and fails to start if it cannot
+	RoleLeader = "leader"
+	// RoleFollower never leads and forwards to the leader at LeaderURL
+	RoleFollower = "follower"
+)
+
+// Config is the resolved configuration shared by the leader, followers,
+// election and daemon so they all agree on where the leader lives
+type Config struct {
+	// Addr is the address the leader listens on, e.g. "127.0.0.1:1994"
+	Addr string
+	// LeaderURL is the base URL followers and proxies use to reach the
+	// leader. Derived from Addr unless set explicitly.
+	LeaderURL string
+	// Role is RoleAuto, RoleLeader or RoleFollower
+	Role string
+	// Profile is the name of the selected profile, if any
+	Profile string
+	// Path is the config file given with -config or FIGMA_BRIDGE_CONFIG,
+	// empty for the default location
+	Path string
+	// Token is the shared secret required on /rpc, /mcp and other
+	// non-plugin endpoints
+	Token string
+	// TokenFile is where Token is stored when it was not given explicitly
+	TokenFile string
+	// EpochFile persists the highest leader epoch handed out on this machine
+	EpochFile string
+	// LockFile is held by the leader and tells other processes where it
+	// listens
+	LockFile string
+	// AllowedOrigins lists the Origin headers accepted on /ws
+	AllowedOrigins []string
+	// RecordFile, if set, receives every plugin request and answer as JSONL
+	RecordFile string
+	// ReplayFile, if set, is a recorded session the leader answers from
+	// instead of the plugin
+	ReplayFile string
+	// TraceFile, if set, receives spans as OTLP/JSON lines
+	TraceFile string
+	// TraceEndpoint, if set, is an OTLP/HTTP collector spans are posted to,
+	// e.g. http://localhost:4318/v1/traces
+	TraceEndpoint string
+	// Timeouts overrides how long each tool waits for the plugin
+	Timeouts bridge.Timeouts
+
+	// leaderURLSet is true when LeaderURL was given rather than derived
+	leaderURLSet bool
+}
+
+// File is the on-disk config format.
+//
+//	{
+//	  "addr": ":1994",
+//	  "timeouts": {"get_screenshot": "5m"},
+//	  "profiles": {
+//	    "design": {"port": 2001},
+//	    "marketing": {"port": 2002}
+//	  }
+//	}
+type File struct {
+	Profile        string             `json:"profile,omitempty"`
+	Addr           string             `json:"addr,omitempty"`
+	Port           int                `json:"port,omitempty"`
+	LeaderURL      string             `json:"leaderUrl,omitempty"`
+	Role           string             `json:"role,omitempty"`
+	TokenFile      string             `json:"tokenFile,omitempty"`
+	AllowedOrigins []string           `json:"allowedOrigins,omitempty"`
+	AllowNull      bool               `json:"allowNullOrigin,omitempty"`
+	Timeouts       map[string]string  `json:"timeouts,omitempty"`
+	Profiles       map[string]Profile `json:"profiles,omitempty"`
+}
+
+// Profile overrides the top-level settings so several bridges can coexist on
+// one machine, each on its own port
+type Profile struct {
+	Addr           string   `json:"addr,omitempty"`
+	Port           int      `json:"port,omitempty"`
+	LeaderURL      string   `json:"leaderUrl,omitempty"`
+	Role           string   `json:"role,omitempty"`
+	TokenFile      string   `json:"tokenFile,omitempty"`
+	AllowedOrigins []string `json:"allowedOrigins,omitempty"`
+}
+
+// Flags holds the command line flags registered by RegisterFlags
+type Flags struct {
+	fs        *flag.FlagSet
+	path      string
+	profile   string
+	addr      string
+	port      int
+	leaderURL string
+	role      string
+	token     string
+	tokenFile string
+	origins   string
+	allowNull bool
+	record    string
+	replay    string
+	traceFile string
+	traceURL  string
+	timeouts  string
+}
+
+// RegisterFlags adds the shared config flags to fs. Call Load after fs has
+// been parsed.
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{fs: fs}
+	fs.StringVar(&f.path, "config", "", "path to config file (default "+DefaultPath()+")")
+	fs.StringVar(&f.profile, "profile", "", "config profile to use")
+	fs.StringVar(&f.addr, "addr", "", "leader listen address (default "+DefaultAddr+")")
+	fs.IntVar(&f.port, "port", 0, "leader port, overrides the port in -addr")
+	fs.StringVar(&f.leaderURL, "leader-url", "", "base URL of the leader (default derived from -addr)")
+	fs.StringVar(&f.role, "role", "", "auto to take part in the election, leader to always lead, or follower to only forward to -leader-url (default auto)")
+	fs.StringVar(&f.token, "token", "", "shared secret for leader endpoints (default read from -token-file)")
+	fs.StringVar(&f.tokenFile, "token-file", "", "file holding the shared secret, created if missing")
+	fs.StringVar(&f.origins, "allowed-origins", "", "comma-separated Origin headers accepted on /ws, or * for any")
+	fs.BoolVar(&f.allowNull, "allow-null-origin", false, `also accept the Origin "null" on /ws, which the Figma desktop app sends; so do sandboxed iframes and file:// pages in your browser`)
+	fs.StringVar(&f.record, "record", "", "append every plugin request and answer to this JSONL session file")
+	fs.StringVar(&f.replay, "replay", "", "answer from this recorded session file instead of the plugin")
+	fs.StringVar(&f.traceFile, "trace-file", "", "append request spans to this file as OTLP/JSON lines")
+	fs.StringVar(&f.traceURL, "trace-endpoint", "", "post request spans to this OTLP/HTTP collector, e.g. http://localhost:4318/v1/traces")
+	fs.StringVar(&f.timeouts, "timeouts", "", "comma-separated tool=duration pairs overriding how long tools wait for Figma, e.g. get_screenshot=5m,get_selection=5s")
+	return f
+}
+
+// DefaultPath returns the config file location used when none is given
+func DefaultPath() string {
+	return filepath.Join(configDir(), "config.json")
+}
+
+// DefaultTokenFile returns where the shared secret for profile is kept
+func DefaultTokenFile(profile string) string {
+	return stateFile("token", profile)
+}
+
+// DefaultEpochFile returns where the leader epoch for profile is kept
+func DefaultEpochFile(profile string) string {
+	return stateFile("epoch", profile)
+}
+
+// DefaultLockFile returns the leader lockfile for profile, in the per-user
+// runtime directory so it does not outlive a reboot
+func DefaultLockFile(profile string) string {
+	name := "leader.lock"
+	if profile != "" {
+		name = "leader-" + profile + ".lock"
+	}
+	return filepath.Join(runtimeDir(), name)
+}
+
+// runtimeDir is where the lockfile lives. The fallback under the shared temp
+// directory could be created by someone else first; discovery refuses it
+// unless it is ours and private.
+func runtimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "figma-bridge")
+	}
+	return filepath.Join(os.TempDir(), "figma-bridge-"+strconv.Itoa(os.Getuid()))
+}
+
+// Locator finds the leader for this configuration, through the lockfile or
+// else at LeaderURL. An explicit LeaderURL, e.g. a remote leader, is used as
+// is without looking at the local lockfile.
+func (c Config) Locator() discovery.Locator {
+	lockFile := c.LockFile
+	if c.leaderURLSet {
+		lockFile = ""
+	}
+	return discovery.Locator{LockFile: lockFile, URL: c.LeaderURL, Token: c.Token}
+}
+
+func stateFile(name, profile string) string {
+	if profile == "" {
+		return filepath.Join(configDir(), name)
+	}
+	return filepath.Join(configDir(), name+"-"+profile)
+}
+
+func configDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "."
+	}
+	return filepath.Join(dir, "figma-bridge")
+}
+
+// Load resolves the configuration from defaults, the config file, the
+// environment and the parsed flags, in increasing order of precedence
+func (f *Flags) Load() (Config, error) {
+	set := make(map[string]bool)
+	f.fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+
+	path := firstNonEmpty(flagValue(set, "config", f.path), os.Getenv(EnvConfig))
+	file, err := readFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg := Config{Addr: DefaultAddr, Path: path}
+	var port int
+	var leaderURL string
+
+	// Config file, top level
+	cfg.Addr = firstNonEmpty(file.Addr, cfg.Addr)
+	port = file.Port
+	leaderURL = file.LeaderURL
+	cfg.Role = file.Role
+	cfg.TokenFile = file.TokenFile
+	cfg.AllowedOrigins = file.AllowedOrigins
+	allowNull := file.AllowNull
+	cfg.Timeouts = make(bridge.Timeouts)
+	for tool, value := range file.Timeouts {
+		d, err := bridge.ParseTimeout(value)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid timeout for %s in config file: %w", tool, err)
+		}
+		cfg.Timeouts[tool] = d
+	}
+
+	// Profile from the config file
+	cfg.Profile = firstNonEmpty(flagValue(set, "profile", f.profile), os.Getenv(EnvProfile), file.Profile)
+	if cfg.Profile != "" {
+		p, ok := file.Profiles[cfg.Profile]
+		if !ok {
+			return Config{}, fmt.Errorf("profile %q not found in config file", cfg.Profile)
+		}
+		if p.Addr != "" {
+			cfg.Addr = p.Addr
+			port = 0
+		}
+		if p.Port != 0 {
+			port = p.Port
+		}
+		leaderURL = firstNonEmpty(p.LeaderURL, leaderURL)
+		cfg.Role = firstNonEmpty(p.Role, cfg.Role)
+		cfg.TokenFile = firstNonEmpty(p.TokenFile, cfg.TokenFile)
+		if len(p.AllowedOrigins) > 0 {
+			cfg.AllowedOrigins = p.AllowedOrigins
+		}
+	}
+
+	// Environment
+	if v := os.Getenv(EnvAddr); v != "" {
+		cfg.Addr = v
+		port = 0
+	}
+	if v := os.Getenv(EnvPort); v != "" {
+		p, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid %s %q: %w", EnvPort, v, err)
+		}
+		port = p
+	}
+	leaderURL = firstNonEmpty(os.Getenv(EnvLeaderURL), leaderURL)
+	cfg.Role = firstNonEmpty(os.Getenv(EnvRole), cfg.Role)
+	cfg.Token = os.Getenv(EnvToken)
+	cfg.TokenFile = firstNonEmpty(os.Getenv(EnvTokenFile), cfg.TokenFile)
+	if v := os.Getenv(EnvOrigins); v != "" {
+		cfg.AllowedOrigins = splitList(v)
+	}
+	if v := os.Getenv(EnvAllowNull); v != "" {
+		if allowNull, err = strconv.ParseBool(v); err != nil {
+			return Config{}, fmt.Errorf("invalid %s %q: %w", EnvAllowNull, v, err)
+		}
+	}
+	cfg.RecordFile = os.Getenv(EnvRecord)
+	cfg.ReplayFile = os.Getenv(EnvReplay)
+	cfg.TraceFile = os.Getenv(EnvTraceFile)
+	cfg.TraceEndpoint = firstNonEmpty(os.Getenv(EnvTraceEndpoint), os.Getenv(envOTLPEndpoint))
+	if err := mergeTimeouts(cfg.Timeouts, os.Getenv(EnvTimeouts)); err != nil {
+		return Config{}, fmt.Errorf("invalid %s: %w", EnvTimeouts, err)
+	}
+
+	// Flags
+	if set["addr"] {
+		cfg.Addr = f.addr
+		port = 0
+	}
+	if set["port"] {
+		port = f.port
+	}
+	if set["leader-url"] {
+		leaderURL = f.leaderURL
+	}
+	if set["role"] {
+		cfg.Role = f.role
+	}
+	if set["token"] {
+		cfg.Token = f.token
+	}
+	if set["token-file"] {
+		cfg.TokenFile = f.tokenFile
+	}
+	if set["allowed-origins"] {
+		cfg.AllowedOrigins = splitList(f.origins)
+	}
+	if set["allow-null-origin"] {
+		allowNull = f.allowNull
+	}
+	if set["record"] {
+		cfg.RecordFile = f.record
+	}
+	if set["replay"] {
+		cfg.ReplayFile = f.replay
+	}
+	if set["trace-file"] {
+		cfg.TraceFile = f.traceFile
+	}
+	if set["trace-endpoint"] {
+		cfg.TraceEndpoint = f.traceURL
+	}
+	if err := mergeTimeouts(cfg.Timeouts, f.timeouts); err != nil {
+		return Config{}, fmt.Errorf("invalid -timeouts: %w", err)
+	}
+
+	host, addrPort, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid listen address %q: %w", cfg.Addr, err)
+	}
+	if port != 0 {
+		if port < 0 || port > 65535 {
+			return Config{}, fmt.Errorf("invalid port %d", port)
+		}
+		addrPort = strconv.Itoa(port)
+		cfg.Addr = net.JoinHostPort(host, addrPort)
+	}
+
+	cfg.LeaderURL = leaderURL
+	cfg.leaderURLSet = leaderURL != ""
+	if cfg.LeaderURL == "" {
+		cfg.LeaderURL = BaseURL(cfg.Addr)
+	}
+	cfg.LeaderURL = strings.TrimSuffix(cfg.LeaderURL, "/")
+
+	switch cfg.Role {
+	case "":
+		cfg.Role = RoleAuto
+	case RoleAuto, RoleLeader, RoleFollower:
+	default:
+		return Config{}, fmt.Errorf("invalid role %q (want %s, %s or %s)", cfg.Role, RoleAuto, RoleLeader, RoleFollower)
+	}
+
+	if cfg.RecordFile != "" && cfg.ReplayFile != "" {
+		return Config{}, fmt.Errorf("cannot record and replay at the same time")
+	}
+
+	if len(cfg.AllowedOrigins) == 0 {
+		cfg.AllowedOrigins = auth.DefaultOrigins
+	}
+	if allowNull && !slices.Contains(cfg.AllowedOrigins, auth.NullOrigin) {
+		cfg.AllowedOrigins = append(slices.Clone(cfg.AllowedOrigins), auth.NullOrigin)
+	}
+	if cfg.TokenFile == "" {
+		cfg.TokenFile = DefaultTokenFile(cfg.Profile)
+	}
+	cfg.EpochFile = DefaultEpochFile(cfg.Profile)
+	cfg.LockFile = DefaultLockFile(cfg.Profile)
+	if cfg.Token == "" {
+		token, err := auth.LoadOrCreateToken(cfg.TokenFile)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.Token = token
+	}
+	return cfg, nil
+}
+
+// Args returns the flags that make Load, in another process, resolve the
+// same configuration, e.g. for the daemon `stdio` starts. The token is left
+// out so it does not show up in ps; pass it in EnvToken.
+func (c Config) Args() []string {
+	var args []string
+	add := func(name, value string) {
+		if value != "" {
+			args = append(args, "-"+name, value)
+		}
+	}
+	// The profile also picks the lockfile and epoch, so it travels with
+	// the file that defines it
+	add("config", c.Path)
+	add("profile", c.Profile)
+	add("addr", c.Addr)
+	if c.leaderURLSet {
+		add("leader-url", c.LeaderURL)
+	}
+	add("role", c.Role)
+	add("token-file", c.TokenFile)
+	add("allowed-origins", strings.Join(c.AllowedOrigins, ","))
+	add("record", c.RecordFile)
+	add("replay", c.ReplayFile)
+	add("trace-file", c.TraceFile)
+	add("trace-endpoint", c.TraceEndpoint)
+
+	tools := slices.Sorted(maps.Keys(c.Timeouts))
+	timeouts := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		timeouts = append(timeouts, tool+"="+c.Timeouts[tool].String())
+	}
+	add("timeouts", strings.Join(timeouts, ","))
+	return args
+}
+
+// BaseURL turns a listen address such as ":1994" into the URL local clients
+// use to reach it
+func BaseURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://" + addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// readFile loads the config file. A missing file at the default location is
+// not an error; a missing file that was asked for explicitly is.
+func readFile(path string) (File, error) {
+	explicit := path != ""
+	if !explicit {
+		path = DefaultPath()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !explicit {
+			return File{}, nil
+		}
+		return File{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return File{}, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// mergeTimeouts adds the tool=duration pairs in value to t, replacing the
+// timeouts of tools already there
+func mergeTimeouts(t bridge.Timeouts, value string) error {
+	parsed, err := bridge.ParseTimeouts(value)
+	if err != nil {
+		return err
+	}
+	for tool, d := range parsed {
+		t[tool] = d
+	}
+	return nil
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func flagValue(set map[string]bool, name, value string) string {
+	if set[name] {
+		return value
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
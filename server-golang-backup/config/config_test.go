@@ -0,0 +1,223 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestLoadPrecedence checks that flags beat the environment, which beats
+// the profile, which beats the top level of the config file, which beats
+// the defaults
+func TestLoadPrecedence(t *testing.T) {
+	const file = `{
+		"addr": "127.0.0.1:2000",
+		"role": "follower",
+		"timeouts": {"get_node": "11s"},
+		"profiles": {
+			"design": {"port": 2001, "role": "leader"},
+			"remote": {"leaderUrl": "http://devbox:1994/"}
+		}
+	}`
+
+	tests := []struct {
+		name string
+		file bool
+		env  map[string]string
+		args []string
+
+		addr, leaderURL, role, token string
+		getNode                      time.Duration
+	}{
+		{
+			name: "defaults",
+			addr: DefaultAddr, leaderURL: "http://127.0.0.1:1994", role: RoleAuto, token: "file-token",
+			getNode: 30 * time.Second,
+		},
+		{
+			name: "file",
+			file: true,
+			addr: "127.0.0.1:2000", leaderURL: "http://127.0.0.1:2000", role: RoleFollower, token: "file-token",
+			getNode: 11 * time.Second,
+		},
+		{
+			name: "profile over file",
+			file: true,
+			args: []string{"-profile", "design"},
+			addr: "127.0.0.1:2001", leaderURL: "http://127.0.0.1:2001", role: RoleLeader, token: "file-token",
+			getNode: 11 * time.Second,
+		},
+		{
+			name: "profile from env",
+			file: true,
+			env:  map[string]string{EnvProfile: "remote"},
+			addr: "127.0.0.1:2000", leaderURL: "http://devbox:1994", role: RoleFollower, token: "file-token",
+			getNode: 11 * time.Second,
+		},
+		{
+			name: "env over profile",
+			file: true,
+			env: map[string]string{
+				EnvPort:     "3000",
+				EnvRole:     RoleAuto,
+				EnvToken:    "env-token",
+				EnvTimeouts: "get_node=12s",
+			},
+			args: []string{"-profile", "design"},
+			addr: "127.0.0.1:3000", leaderURL: "http://127.0.0.1:3000", role: RoleAuto, token: "env-token",
+			getNode: 12 * time.Second,
+		},
+		{
+			name: "flags over env",
+			file: true,
+			env: map[string]string{
+				EnvAddr:      "127.0.0.1:3000",
+				EnvLeaderURL: "http://env:1994",
+				EnvRole:      RoleAuto,
+				EnvToken:     "env-token",
+				EnvTimeouts:  "get_node=12s",
+			},
+			args: []string{"-profile", "design", "-port", "4000", "-leader-url", "http://flag:1994", "-role", RoleLeader,
+				"-token", "flag-token", "-timeouts", "get_node=13s"},
+			addr: "127.0.0.1:4000", leaderURL: "http://flag:1994", role: RoleLeader, token: "flag-token",
+			getNode: 13 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "config.json")
+			content := "{}"
+			if tt.file {
+				content = file
+			}
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			tokenFile := filepath.Join(dir, "token")
+			if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			clearEnv(t)
+			t.Setenv(EnvConfig, path)
+			t.Setenv(EnvTokenFile, tokenFile)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			flags := RegisterFlags(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := flags.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cfg.Addr != tt.addr || cfg.LeaderURL != tt.leaderURL || cfg.Role != tt.role || cfg.Token != tt.token {
+				t.Errorf("got addr %s, leader URL %s, role %s, token %s; want %s, %s, %s, %s",
+					cfg.Addr, cfg.LeaderURL, cfg.Role, cfg.Token, tt.addr, tt.leaderURL, tt.role, tt.token)
+			}
+			if got := cfg.Timeouts.For("get_node"); got != tt.getNode {
+				t.Errorf("get_node timeout = %s, want %s", got, tt.getNode)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsUnknownProfile(t *testing.T) {
+	clearEnv(t)
+	t.Setenv(EnvToken, "token")
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"profiles": {"design": {"port": 2001}}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := RegisterFlags(fs)
+	if err := fs.Parse([]string{"-config", path, "-profile", "nope"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := flags.Load(); err == nil {
+		t.Fatal("unknown profile accepted")
+	}
+}
+
+// clearEnv unsets every variable Load reads for the rest of the test
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{EnvConfig, EnvProfile, EnvAddr, EnvPort, EnvLeaderURL, EnvToken, EnvTokenFile,
+		EnvOrigins, EnvAllowNull, EnvRole, EnvRecord, EnvReplay, EnvTraceFile, EnvTimeouts, EnvTraceEndpoint, envOTLPEndpoint} {
+		t.Setenv(name, "")
+	}
+}
+
+// TestArgsReproduceConfig loads Args in a fresh flag set, as the daemon
+// started by stdio does, and expects the same configuration. The profile
+// lives in a config file outside the default location, so it only resolves
+// if the file is passed along with it.
+func TestArgsReproduceConfig(t *testing.T) {
+	clearEnv(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bridge.json")
+	if err := os.WriteFile(path, []byte(`{"profiles": {"design": {"port": 2001, "allowedOrigins": ["https://www.figma.com"]}}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(EnvTokenFile, filepath.Join(dir, "token"))
+
+	load := func(args ...string) Config {
+		t.Helper()
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags := RegisterFlags(fs)
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := flags.Load()
+		if err != nil {
+			t.Fatalf("load %v: %v", args, err)
+		}
+		return cfg
+	}
+	cfg := load("-config", path, "-profile", "design", "-leader-url", "http://devbox:2001",
+		"-record", filepath.Join(dir, "session.jsonl"), "-trace-endpoint", "http://localhost:4318/v1/traces",
+		"-timeouts", "get_node=7s,get_screenshot=1m30s")
+
+	got := load(cfg.Args()...)
+	if !reflect.DeepEqual(got, cfg) {
+		t.Fatalf("Args %v resolve to\n%+v\nwant\n%+v", cfg.Args(), got, cfg)
+	}
+}
+
+// TestLeaderURLSkipsLockfile pins a follower to a remote leader: it must
+// not be sent to whatever local leader the lockfile names instead
+func TestLeaderURLSkipsLockfile(t *testing.T) {
+	clearEnv(t)
+	t.Setenv(EnvTokenFile, filepath.Join(t.TempDir(), "token"))
+
+	for _, tt := range []struct {
+		args     []string
+		lockFile bool
+		url      string
+	}{
+		{[]string{"-role", "follower", "-leader-url", "http://devbox:2001/"}, false, "http://devbox:2001"},
+		{[]string{"-role", "follower"}, true, "http://127.0.0.1:1994"},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags := RegisterFlags(fs)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := flags.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		locator := cfg.Locator()
+		if (locator.LockFile != "") != tt.lockFile || locator.URL != tt.url {
+			t.Errorf("%v: locator = %+v, want lockfile %v and URL %s", tt.args, locator, tt.lockFile, tt.url)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/config"
+	"figma-mcp-bridge-v2/leader"
+	mcpbridge "figma-mcp-bridge-v2/mcp"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// SessionTTL is how long an MCP session may go without a request before the
+// daemon forgets it. Proxies ping more often than this while their client is
+// quiet, see keepAliveInterval.
+const SessionTTL = 30 * time.Minute
+
+// Daemon is the long-lived `figma-bridge serve` process. It always holds the
+// leader role, serves MCP over streamable HTTP at /mcp for the thin stdio
+// proxies, and exits on its own once no client has been connected for the
+// idle timeout.
+type Daemon struct {
+	cfg         config.Config
+	idleTimeout time.Duration
+	leader      *leader.Leader
+	sessions    *mcpbridge.Sessions
+	shutdownCh  chan struct{}
+}
+
+// New creates a new Daemon listening on cfg.Addr. An idleTimeout of zero
+// keeps the daemon running until it is told to stop.
+func New(cfg config.Config, idleTimeout time.Duration) *Daemon {
+	return &Daemon{
+		cfg:         cfg,
+		idleTimeout: idleTimeout,
+		sessions:    mcpbridge.NewSessions(),
+		shutdownCh:  make(chan struct{}, 1),
+	}
+}
+
+// Run starts the leader and blocks until ctx is cancelled, the daemon has
+// been idle for too long, or a client asks it to shut down
+func (d *Daemon) Run(ctx context.Context) error {
+	server := mcp.NewServer(&mcp.Implementation{
+		Name:    "figma-bridge",
+		Version: leader.Version,
+	}, nil)
+	server.AddReceivingMiddleware(d.sessions.Middleware())
+
+	tools := &mcpbridge.Tools{Handler: d, Timeouts: d.cfg.Timeouts}
+	tools.Register(server)
+
+	d.leader = leader.New(d.cfg.Addr, leader.Options{
+		Token:          d.cfg.Token,
+		AllowedOrigins: d.cfg.AllowedOrigins,
+		EpochFile:      d.cfg.EpochFile,
+		LockFile:       d.cfg.LockFile,
+		RecordFile:     d.cfg.RecordFile,
+		ReplayFile:     d.cfg.ReplayFile,
+		Clients:        d.sessions.ClientNames,
+		Timeouts:       d.cfg.Timeouts,
+	})
+	d.leader.Handle("/mcp", mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server {
+		return server
+	}, nil))
+	d.leader.Handle("/shutdown", http.HandlerFunc(d.handleShutdown))
+	if err := d.leader.Start(); err != nil {
+		return err
+	}
+	defer d.leader.Stop()
+
+	log.Printf("Daemon serving MCP at /mcp on %s", d.leader.Addr())
+
+	ticker := time.NewTicker(idleCheckInterval(d.idleTimeout))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-d.shutdownCh:
+			log.Println("Shutdown requested")
+			return nil
+		case <-ticker.C:
+			// The daemon always leads, so a reason to step down is moot;
+			// the check still nudges a stuck plugin to reconnect
+			_ = d.leader.SelfCheck()
+			if n := d.sessions.Expire(SessionTTL); n > 0 {
+				log.Printf("Closed %d MCP sessions without requests for %s", n, SessionTTL)
+			}
+			if d.idleTimeout > 0 && d.sessions.Idle() >= d.idleTimeout {
+				log.Printf("No clients for %s, exiting", d.idleTimeout)
+				return nil
+			}
+		}
+	}
+}
+
+// Send implements ToolHandler by forwarding to the leader's bridge
+func (d *Daemon) Send(ctx context.Context, requestType string, nodeIDs []string) (bridge.Response, error) {
+	return d.SendWithParams(ctx, requestType, nodeIDs, nil)
+}
+
+// SendWithParams implements ToolHandler by forwarding to the leader's bridge
+func (d *Daemon) SendWithParams(ctx context.Context, requestType string, nodeIDs []string, params map[string]interface{}) (bridge.Response, error) {
+	ctx = bridge.WithOrigin(ctx, bridge.Origin{Node: d.leader.Identity().ID})
+	return d.leader.SendWithParams(ctx, requestType, nodeIDs, params)
+}
+
+// ClusterStatus implements mcpbridge.StatusProvider
+func (d *Daemon) ClusterStatus(ctx context.Context) (leader.ClusterStatus, error) {
+	return d.leader.ClusterStatus(), nil
+}
+
+// handleShutdown lets a proxy with a different version replace this daemon
+func (d *Daemon) handleShutdown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "shutting down"})
+
+	select {
+	case d.shutdownCh <- struct{}{}:
+	default:
+	}
+}
+
+func idleCheckInterval(idleTimeout time.Duration) time.Duration {
+	if idleTimeout > 0 && idleTimeout < 10*time.Second {
+		return idleTimeout
+	}
+	return 10 * time.Second
+}
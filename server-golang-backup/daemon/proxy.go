@@ -0,0 +1,233 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"figma-mcp-bridge-v2/auth"
+	"figma-mcp-bridge-v2/config"
+	"figma-mcp-bridge-v2/discovery"
+	"figma-mcp-bridge-v2/leader"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// keepAliveInterval is how often Proxy pings the daemon while the session
+// is quiet, well within SessionTTL
+const keepAliveInterval = 5 * time.Minute
+
+// keepAliveID marks the proxy's own pings, whose responses the MCP client
+// must not see
+var keepAliveID, _ = jsonrpc.MakeID("figma-bridge-keepalive")
+
+// How long EnsureRunning waits for a freshly spawned daemon to answer /ping
+const startupTimeout = 10 * time.Second
+
+// EnsureRunning makes sure a daemon with our version is running, finding it
+// through the lockfile or else at cfg.LeaderURL. A missing daemon is started
+// in the background listening on cfg.Addr; one running a different version
+// is asked to shut down and replaced.
+func EnsureRunning(ctx context.Context, cfg config.Config) error {
+	locator := cfg.Locator()
+	baseURL, token := locator.Leader()
+
+	ping, err := Ping(ctx, baseURL, token)
+	if err == nil && ping.Version == leader.Version {
+		return nil
+	}
+	if err == nil {
+		log.Printf("Daemon runs version %s, we are %s; restarting it", ping.Version, leader.Version)
+		if err := requestShutdown(ctx, baseURL, token); err != nil {
+			return fmt.Errorf("failed to stop outdated daemon: %w", err)
+		}
+		if err := waitForExit(ctx, cfg.Addr, cfg.LockFile); err != nil {
+			return err
+		}
+	}
+
+	if err := spawn(cfg); err != nil {
+		return fmt.Errorf("failed to start daemon: %w", err)
+	}
+
+	deadline := time.Now().Add(startupTimeout)
+	for time.Now().Before(deadline) {
+		// Resolve again: the daemon may have picked another port
+		baseURL, token := locator.Leader()
+		if ping, err := Ping(ctx, baseURL, token); err == nil {
+			if ping.Version != leader.Version {
+				return fmt.Errorf("daemon at %s runs version %s, expected %s", baseURL, ping.Version, leader.Version)
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	return fmt.Errorf("daemon did not start on %s within %s", cfg.Addr, startupTimeout)
+}
+
+// Ping probes the daemon's /ping endpoint and verifies it shares our token
+func Ping(ctx context.Context, baseURL, token string) (leader.PingResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	return leader.Probe(ctx, http.DefaultClient, baseURL, token)
+}
+
+// Proxy forwards MCP traffic between stdin/stdout and the daemon's /mcp
+// endpoint until either side closes
+func Proxy(ctx context.Context, cfg config.Config) error {
+	baseURL, token := cfg.Locator().Leader()
+
+	local, err := (&mcp.StdioTransport{}).Connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+
+	remote, err := (&mcp.StreamableClientTransport{
+		Endpoint:   baseURL + "/mcp",
+		HTTPClient: &http.Client{Transport: &auth.Transport{Token: token}},
+	}).Connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+
+	errCh := make(chan error, 3)
+	go func() { errCh <- pump(ctx, local, remote, nil) }()
+	go func() { errCh <- pump(ctx, remote, local, isKeepAlive) }()
+	go func() { errCh <- keepAlive(ctx, remote, keepAliveInterval) }()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// pump copies messages from src to dst, leaving out those skip matches. A
+// clean EOF from src is not an error.
+func pump(ctx context.Context, src, dst mcp.Connection, skip func(jsonrpc.Message) bool) error {
+	for {
+		msg, err := src.Read(ctx)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if skip != nil && skip(msg) {
+			continue
+		}
+		if err := dst.Write(ctx, msg); err != nil {
+			return err
+		}
+	}
+}
+
+// keepAlive pings the daemon every interval, so it does not expire a
+// session whose client is connected but quiet
+func keepAlive(ctx context.Context, remote mcp.Connection, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if err := remote.Write(ctx, &jsonrpc.Request{ID: keepAliveID, Method: "ping"}); err != nil {
+			return err
+		}
+	}
+}
+
+func isKeepAlive(msg jsonrpc.Message) bool {
+	resp, ok := msg.(*jsonrpc.Response)
+	return ok && resp.ID == keepAliveID
+}
+
+func requestShutdown(ctx context.Context, baseURL, token string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/shutdown", nil)
+	if err != nil {
+		return err
+	}
+	auth.SetHeader(req, token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("shutdown returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// waitForExit waits until the outdated daemon has released both the port
+// and the lockfile, so the replacement can take them
+func waitForExit(ctx context.Context, addr, lockFile string) error {
+	deadline := time.Now().Add(startupTimeout)
+	for time.Now().Before(deadline) {
+		if portFree(addr) && (lockFile == "" || !discovery.Held(lockFile)) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	return fmt.Errorf("outdated daemon did not release %s", addr)
+}
+
+func portFree(addr string) bool {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
+
+// spawn starts `figma-bridge serve` with our configuration, detached from
+// this process and logging to a file in the temp directory
+func spawn(cfg config.Config) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	logPath := filepath.Join(os.TempDir(), "figma-bridge-daemon.log")
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, append([]string{"serve"}, cfg.Args()...)...)
+	// Pass the token through the environment so it does not show up in ps
+	cmd.Env = append(os.Environ(), config.EnvToken+"="+cfg.Token)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	detach(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	log.Printf("Started daemon (pid %d, log %s)", cmd.Process.Pid, logPath)
+	return cmd.Process.Release()
+}
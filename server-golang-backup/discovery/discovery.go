@@ -0,0 +1,149 @@
+// Package discovery lets bridge processes on one machine find the leader
+// through a lockfile instead of probing a well-known port. The leader holds
+// an exclusive lock on the file for as long as it runs and records where it
+// listens; the lock disappears with the process, so a crashed leader is
+// detected without waiting for timeouts.
+package discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrHeld is returned by Acquire when another process holds the lockfile
+var ErrHeld = errors.New("lockfile is held by another process")
+
+// ErrUnsafeDir is returned by Acquire when the lockfile's directory could
+// have been created or changed by another user, who could then point us at
+// their own leader
+var ErrUnsafeDir = errors.New("lockfile directory must be owned by the current user with mode 0700")
+
+// Record is what the leader writes into the lockfile. It holds no secret:
+// whoever reads it must still prove the leader knows their token.
+type Record struct {
+	PID       int       `json:"pid"`
+	Addr      string    `json:"addr"`
+	URL       string    `json:"url"`
+	Version   string    `json:"version"`
+	Epoch     uint64    `json:"epoch"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// Lock is a held lockfile
+type Lock struct {
+	file *os.File
+}
+
+// Acquire takes the lockfile at path, creating it and its directory if
+// needed. It does not block: if a live process holds the lock it returns
+// ErrHeld.
+func Acquire(path string) (*Lock, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	if err := privateDir(dir); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &Lock{file: file}, nil
+}
+
+// Write replaces the record in the lockfile
+func (l *Lock) Write(rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := l.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := l.file.WriteAt(data, 0); err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+// Release clears the record and gives up the lock. The file itself is left
+// in place: removing it would let two processes lock different inodes.
+func (l *Lock) Release() {
+	_ = l.file.Truncate(0)
+	_ = unlockFile(l.file)
+	l.file.Close()
+}
+
+// Lookup returns the record of the leader holding the lockfile at path. It
+// reports false if the file is missing or empty, its directory is not
+// private, nobody holds the lock, or the recorded process is dead.
+func Lookup(path string) (Record, bool) {
+	if privateDir(filepath.Dir(path)) != nil {
+		return Record{}, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		return Record{}, false
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return Record{}, false
+	}
+	if !Held(path) || !processAlive(rec.PID) {
+		return Record{}, false
+	}
+	return rec, true
+}
+
+// Held reports whether some process currently holds the lock on path
+func Held(path string) bool {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	if err := lockFile(file); err != nil {
+		return errors.Is(err, ErrHeld)
+	}
+	_ = unlockFile(file)
+	return false
+}
+
+// Locator finds the leader: through the lockfile when it names a live
+// leader, otherwise at a fixed URL
+type Locator struct {
+	LockFile string
+	URL      string
+	Token    string
+}
+
+// Leader returns the base URL and token to reach the current leader with.
+// The token is always the configured one; callers verify the leader's
+// /ping proof against it before trusting the URL.
+func (l Locator) Leader() (url, token string) {
+	if l.LockFile != "" {
+		if rec, ok := Lookup(l.LockFile); ok {
+			return rec.URL, l.Token
+		}
+	}
+	return l.URL, l.Token
+}
+
+// Live reports whether the lockfile names a live leader. Without a lockfile
+// it always reports true, leaving the decision to a /ping probe.
+func (l Locator) Live() bool {
+	if l.LockFile == "" {
+		return true
+	}
+	_, ok := Lookup(l.LockFile)
+	return ok
+}
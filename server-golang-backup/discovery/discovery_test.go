@@ -0,0 +1,52 @@
+//go:build !windows
+
+package discovery
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestAcquireRefusesSharedDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "figma-bridge")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Acquire(filepath.Join(dir, "leader.lock")); !errors.Is(err, ErrUnsafeDir) {
+		t.Fatalf("Acquire in a 0755 directory: got %v, want ErrUnsafeDir", err)
+	}
+
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(t.TempDir(), link); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Acquire(filepath.Join(link, "leader.lock")); !errors.Is(err, ErrUnsafeDir) {
+		t.Fatalf("Acquire through a symlink: got %v, want ErrUnsafeDir", err)
+	}
+}
+
+func TestLocatorUsesConfiguredToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "figma-bridge", "leader.lock")
+	lock, err := Acquire(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Release()
+	// A lockfile written by an older leader, or by someone else, may carry
+	// a token; it must not replace ours
+	if _, err := lock.file.WriteAt([]byte(`{"pid":`+strconv.Itoa(os.Getpid())+`,"url":"http://127.0.0.1:2000","token":"planted"}`), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	l := Locator{LockFile: path, URL: "http://127.0.0.1:1994", Token: "ours"}
+	url, token := l.Leader()
+	if url != "http://127.0.0.1:2000" || token != "ours" {
+		t.Fatalf("Leader() = %s, %s; want the lockfile's URL with our token", url, token)
+	}
+}
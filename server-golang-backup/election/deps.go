@@ -0,0 +1,118 @@
+package election
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"figma-mcp-bridge-v2/discovery"
+	"figma-mcp-bridge-v2/leader"
+)
+
+// Clock abstracts time so tests can drive the election step by step
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker is the part of time.Ticker the election uses
+type Ticker interface {
+	Chan() <-chan time.Time
+	Stop()
+}
+
+// Pinger is how the election observes the current leader
+type Pinger interface {
+	// Live reports false when the leader is known to be gone without
+	// having to ask it, e.g. because its lockfile was released
+	Live() bool
+	// Ping verifies the leader and returns what it reports about itself
+	Ping(ctx context.Context) (leader.PingResponse, error)
+	// Watch blocks until the leader announces an event for node id
+	Watch(ctx context.Context, id string) (leader.WatchEvent, error)
+	// RequestTakeover asks the leader to hand over to req.ID
+	RequestTakeover(ctx context.Context, req leader.TakeoverRequest) error
+}
+
+// Watcher learns of the leader's handoff, typically over the follower link
+// of the node being elected
+type Watcher interface {
+	WatchLeader(ctx context.Context) (leader.WatchEvent, error)
+}
+
+// Options replaces the election's dependencies; zero fields get the real
+// implementation
+type Options struct {
+	Clock  Clock
+	Pinger Pinger
+	// Interval returns the period of the role check; by default a random
+	// 3-5s so several instances do not tick in lockstep
+	Interval func() time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.Clock == nil {
+		o.Clock = realClock{}
+	}
+	if o.Interval == nil {
+		o.Interval = func() time.Duration {
+			return time.Duration(3+rand.Intn(3)) * time.Second
+		}
+	}
+	return o
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct{ *time.Ticker }
+
+func (t realTicker) Chan() <-chan time.Time { return t.C }
+
+// httpPinger finds the leader through the lockfile and talks to it over
+// HTTP, except for the watch, which rides on the follower link
+type httpPinger struct {
+	locator discovery.Locator
+	client  *http.Client // short timeout for pings
+	watcher Watcher
+}
+
+// NewHTTPPinger returns the Pinger used outside tests. It watches for
+// handoffs through watcher.
+func NewHTTPPinger(locator discovery.Locator, watcher Watcher) Pinger {
+	return &httpPinger{
+		locator: locator,
+		client:  &http.Client{Timeout: 2 * time.Second},
+		watcher: watcher,
+	}
+}
+
+func (p *httpPinger) Live() bool {
+	return p.locator.Live()
+}
+
+func (p *httpPinger) Ping(ctx context.Context) (leader.PingResponse, error) {
+	url, token := p.locator.Leader()
+	ping, err := leader.Probe(ctx, p.client, url, token)
+	if errors.Is(err, leader.ErrNotLeader) {
+		log.Printf("Something else answers on %s: %v", url, err)
+	}
+	return ping, err
+}
+
+// Watch ignores id: the link already names the node
+func (p *httpPinger) Watch(ctx context.Context, id string) (leader.WatchEvent, error) {
+	return p.watcher.WatchLeader(ctx)
+}
+
+func (p *httpPinger) RequestTakeover(ctx context.Context, req leader.TakeoverRequest) error {
+	url, token := p.locator.Leader()
+	return leader.RequestTakeover(ctx, p.client, url, token, req)
+}
@@ -3,18 +3,31 @@ package election
 import (
 	"context"
 	"log"
-	"math/rand"
-	"net/http"
+	"sync"
 	"time"
+
+	"figma-mcp-bridge-v2/discovery"
+	"figma-mcp-bridge-v2/leader"
 )
 
 // RoleChanger is implemented by Node to allow election to trigger role changes
 type RoleChanger interface {
 	BecomeLeader() error
 	BecomeFollower()
-	RoleInt() int // Returns node.Role as int to avoid circular import
+	RoleInt() int     // Returns node.Role as int to avoid circular import
+	Fenced() bool     // True if a leader with a higher epoch has taken over
+	SelfCheck() error // Non-nil if the leader cannot serve the plugin well
+	ID() string       // Node ID the leader uses to designate a successor
 }
 
+// How long the designated successor gets to bind the port before other
+// followers compete for it
+const handoffWindow = 2 * time.Second
+
+// How long a node that asked an older leader to step down keeps trying to
+// claim leadership; covers the leader draining its in-flight requests
+const upgradeWindow = 10 * time.Second
+
 // Role constants (must match node.Role values)
 const (
 	RoleUnknown = iota
@@ -24,31 +37,41 @@ const (
 
 // Election handles leader detection and role transitions
 type Election struct {
-	node       RoleChanger
-	addr       string
-	leaderURL  string
-	ticker     *time.Ticker
-	stopCh     chan struct{}
-	httpClient *http.Client
+	node    RoleChanger
+	clock   Clock
+	pinger  Pinger
+	opts    Options
+	ticker  Ticker
+	stopCh  chan struct{}
+	checkCh chan struct{}
+
+	mu    sync.Mutex
+	asked string // leader ID we last asked to hand over
 }
 
-// New creates a new Election instance
-func New(addr string, n RoleChanger) *Election {
+// New creates a new Election that finds the leader with locator, accepting
+// only leaders that prove they know its token, and hears of handoffs
+// through watcher
+func New(locator discovery.Locator, n RoleChanger, watcher Watcher) *Election {
+	return NewWithOptions(n, Options{Pinger: NewHTTPPinger(locator, watcher)})
+}
+
+// NewWithOptions creates a new Election with injected dependencies.
+// opts.Pinger is required.
+func NewWithOptions(n RoleChanger, opts Options) *Election {
+	opts = opts.withDefaults()
 	return &Election{
-		node:      n,
-		addr:      addr,
-		leaderURL: "http://localhost:1994",
-		httpClient: &http.Client{
-			Timeout: 2 * time.Second,
-		},
+		node:    n,
+		clock:   opts.Clock,
+		pinger:  opts.Pinger,
+		opts:    opts,
+		checkCh: make(chan struct{}, 1),
 	}
 }
 
 // Start begins the election process and continuous monitoring
 func (e *Election) Start() {
-	// Random jitter between 3-5 seconds to stagger multiple instances
-	jitter := 3 + rand.Intn(3)
-	e.ticker = time.NewTicker(time.Duration(jitter) * time.Second)
+	e.ticker = e.clock.NewTicker(e.opts.Interval())
 	e.stopCh = make(chan struct{})
 
 	// Initial role determination
@@ -56,6 +79,7 @@ func (e *Election) Start() {
 
 	// Continuous monitoring
 	go e.runTicker()
+	go e.watchLeader()
 }
 
 // Stop stops the election monitoring
@@ -68,10 +92,21 @@ func (e *Election) Stop() {
 	}
 }
 
+// CheckNow asks for a role check without waiting for the next tick, e.g.
+// because a request to the leader just failed. It does not block.
+func (e *Election) CheckNow() {
+	select {
+	case e.checkCh <- struct{}{}:
+	default:
+	}
+}
+
 func (e *Election) runTicker() {
 	for {
 		select {
-		case <-e.ticker.C:
+		case <-e.ticker.Chan():
+			e.checkAndUpdateRole()
+		case <-e.checkCh:
 			e.checkAndUpdateRole()
 		case <-e.stopCh:
 			return
@@ -84,24 +119,114 @@ func (e *Election) checkAndUpdateRole() {
 
 	switch currentRole {
 	case RoleFollower:
-		// Check if leader is still alive
-		if !e.pingLeader() {
+		// Check if leader is still alive. A released lockfile or dead
+		// leader PID settles it without waiting for a ping to time out.
+		ping, ok := e.pingLeader()
+		if !e.pinger.Live() || !ok {
 			// Leader died - try to take over
 			log.Println("Leader not responding, attempting takeover...")
 			if err := e.node.BecomeLeader(); err != nil {
 				log.Printf("Failed to become leader: %v", err)
 			}
+			return
 		}
+		e.upgradeLeader(ping)
 
 	case RoleLeader:
-		// We are leader, nothing to do
-		// Could add self-health checks here if needed
+		// Step down if a newer leader has claimed a higher epoch, so we stop
+		// serving stale plugin and follower connections
+		if e.node.Fenced() {
+			log.Println("Superseded by a newer leader, stepping down")
+			e.node.BecomeFollower()
+			return
+		}
+		// A leader the plugin cannot reach is useless; hand over so the
+		// next election can do better
+		if err := e.node.SelfCheck(); err != nil {
+			log.Printf("Stepping down: %v", err)
+			e.node.BecomeFollower()
+		}
 
 	case RoleUnknown:
 		e.determineRole()
 	}
 }
 
+// watchLeader keeps watching the leader while we are a follower so a
+// leader shutting down can hand over immediately instead of us noticing on
+// the next tick
+func (e *Election) watchLeader() {
+	for {
+		if e.node.RoleInt() != RoleFollower {
+			if !e.sleep(time.Second) {
+				return
+			}
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-e.stopCh:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		event, err := e.pinger.Watch(ctx, e.node.ID())
+		cancel()
+
+		if err != nil {
+			if !e.sleep(time.Second) {
+				return
+			}
+			continue
+		}
+		if event.Event == leader.EventShutdown {
+			e.takeOver(event.Successor == e.node.ID())
+		}
+	}
+}
+
+// takeOver reacts to the leader announcing its shutdown. The designated
+// successor binds the port as soon as it is released; everyone else gives it
+// a head start and then re-runs the normal check.
+func (e *Election) takeOver(successor bool) {
+	if successor {
+		log.Println("Designated as successor, taking over")
+		if e.claim(handoffWindow) {
+			return
+		}
+	} else if !e.sleep(handoffWindow) {
+		return
+	}
+	e.checkAndUpdateRole()
+}
+
+// claim keeps trying to become leader for up to window and reports whether
+// it succeeded
+func (e *Election) claim(window time.Duration) bool {
+	deadline := e.clock.Now().Add(window)
+	for e.clock.Now().Before(deadline) {
+		if err := e.node.BecomeLeader(); err == nil {
+			return true
+		}
+		if !e.sleep(100 * time.Millisecond) {
+			return false
+		}
+	}
+	return false
+}
+
+// sleep waits for d and reports false if the election was stopped meanwhile
+func (e *Election) sleep(d time.Duration) bool {
+	select {
+	case <-e.clock.After(d):
+		return true
+	case <-e.stopCh:
+		return false
+	}
+}
+
 func (e *Election) determineRole() {
 	// Try to become leader first
 	if err := e.node.BecomeLeader(); err == nil {
@@ -110,26 +235,51 @@ func (e *Election) determineRole() {
 	}
 
 	// Port taken - check if it's a valid leader
-	if e.pingLeader() {
+	if ping, ok := e.pingLeader(); ok {
 		e.node.BecomeFollower()
+		e.upgradeLeader(ping)
 	}
 	// If ping fails, next tick will retry
 }
 
-func (e *Election) pingLeader() bool {
+// upgradeLeader asks a leader running an older version to hand over to us,
+// so after an upgrade the cluster converges on the newest binary without
+// restarting editors. The leader names us successor in its handoff; we also
+// claim the port ourselves in case we were not watching yet.
+func (e *Election) upgradeLeader(ping leader.PingResponse) {
+	if !leader.NewerVersion(leader.Version, ping.Version) {
+		return
+	}
+
+	e.mu.Lock()
+	if e.asked == ping.ID {
+		e.mu.Unlock()
+		return
+	}
+	e.asked = ping.ID
+	e.mu.Unlock()
+
+	log.Printf("Leader runs version %s, we run %s; requesting takeover", ping.Version, leader.Version)
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.leaderURL+"/ping", nil)
+	err := e.pinger.RequestTakeover(ctx, leader.TakeoverRequest{
+		ID:          e.node.ID(),
+		Version:     leader.Version,
+		Protocol:    leader.Protocol,
+		MinProtocol: leader.MinProtocol,
+	})
 	if err != nil {
-		return false
+		log.Printf("Takeover request refused: %v", err)
+		return
 	}
+	go e.claim(upgradeWindow)
+}
 
-	resp, err := e.httpClient.Do(req)
-	if err != nil {
-		return false
-	}
-	defer resp.Body.Close()
+func (e *Election) pingLeader() (leader.PingResponse, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
 
-	return resp.StatusCode == http.StatusOK
+	ping, err := e.pinger.Ping(ctx)
+	return ping, err == nil
 }
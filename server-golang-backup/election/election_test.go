@@ -0,0 +1,712 @@
+package election
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"figma-mcp-bridge-v2/config"
+	"figma-mcp-bridge-v2/leader"
+	"figma-mcp-bridge-v2/node"
+)
+
+// The harness runs N elections in-process against a fake clock and a fake
+// network. Nodes "bind" the leader port through fakeNetwork.Listen, ping and
+// watch the leader through fakePinger, and time only moves when the test
+// advances the clock. The clock counts the election goroutines blocked on it
+// or on a watch, so the test knows when they have all reacted to a step.
+
+const testAddr = "127.0.0.1:1994"
+
+// fakeClock fires timers and tickers only when Advance is called
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+	// parked counts goroutines blocked on a timer or a watch; changed is
+	// signalled whenever one more blocks
+	parked  int
+	changed chan struct{}
+}
+
+type fakeTimer struct {
+	clock  *fakeClock
+	at     time.Time
+	period time.Duration // zero for one-shot timers
+	ch     chan time.Time
+	done   bool
+	waiter bool // a goroutine is parked on ch
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0), changed: make(chan struct{}, 1)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After parks the caller: the election always blocks on the channel next
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	t := c.add(d, 0)
+	c.mu.Lock()
+	t.waiter = true
+	c.park(1)
+	c.mu.Unlock()
+	return t.ch
+}
+
+// park records n more blocked goroutines, or fewer woken ones if n is
+// negative. Caller must hold c.mu.
+func (c *fakeClock) park(n int) {
+	c.parked += n
+	if n > 0 {
+		select {
+		case c.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (c *fakeClock) parkedCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.parked
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	return c.add(d, d)
+}
+
+func (c *fakeClock) add(d, period time.Duration) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, at: c.now.Add(d), period: period, ch: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Chan parks the caller unless a tick is already waiting: the election
+// only asks for it in the select it blocks in
+func (t *fakeTimer) Chan() <-chan time.Time {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	if len(t.ch) == 0 && !t.waiter {
+		t.waiter = true
+		t.clock.park(1)
+	}
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() {
+	t.clock.mu.Lock()
+	t.done = true
+	t.clock.mu.Unlock()
+}
+
+// Advance moves time forward by d, firing every timer that falls due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+
+	live := c.timers[:0]
+	for _, t := range c.timers {
+		if !t.done && !t.at.After(c.now) {
+			if t.waiter {
+				t.waiter = false
+				c.park(-1)
+			}
+			select {
+			case t.ch <- c.now:
+			default: // like time.Ticker, drop ticks nobody read
+			}
+			if t.period > 0 {
+				for !t.at.After(c.now) {
+					t.at = t.at.Add(t.period)
+				}
+			} else {
+				t.done = true
+			}
+		}
+		if !t.done {
+			live = append(live, t)
+		}
+	}
+	c.timers = live
+}
+
+// fakeNetwork hands out addresses the way the kernel would: one listener
+// per address. It also plays the leader's /ping and /watch endpoints for
+// whichever node holds testAddr.
+type fakeNetwork struct {
+	clock     *fakeClock
+	mu        sync.Mutex
+	listeners map[string]*fakeListener
+	owner     *fakeNode
+	epoch     uint64
+	term      *term
+}
+
+// term is one leader's tenure, ended either by a handoff or a crash
+type term struct {
+	over     chan struct{}
+	event    *leader.WatchEvent // nil if the leader crashed
+	watchers []string
+	waiting  int // watches blocked until the term is over
+}
+
+func newFakeNetwork(clock *fakeClock) *fakeNetwork {
+	return &fakeNetwork{clock: clock, listeners: make(map[string]*fakeListener)}
+}
+
+// Listen has the signature of net.Listen so it can be handed to
+// leader.Options.Listen as well
+func (fn *fakeNetwork) Listen(network, address string) (net.Listener, error) {
+	fn.mu.Lock()
+	defer fn.mu.Unlock()
+	if _, taken := fn.listeners[address]; taken {
+		return nil, fmt.Errorf("listen %s %s: bind: address already in use", network, address)
+	}
+	l := &fakeListener{network: fn, addr: address, closed: make(chan struct{})}
+	fn.listeners[address] = l
+	return l, nil
+}
+
+type fakeListener struct {
+	network *fakeNetwork
+	addr    string
+	once    sync.Once
+	closed  chan struct{}
+}
+
+func (l *fakeListener) Accept() (net.Conn, error) {
+	<-l.closed
+	return nil, net.ErrClosed
+}
+
+func (l *fakeListener) Close() error {
+	l.once.Do(func() {
+		l.network.mu.Lock()
+		delete(l.network.listeners, l.addr)
+		l.network.mu.Unlock()
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *fakeListener) Addr() net.Addr {
+	addr, _ := net.ResolveTCPAddr("tcp", l.addr)
+	return addr
+}
+
+// fakeNode is a RoleChanger whose leader is nothing but a held listener
+type fakeNode struct {
+	id      string
+	network *fakeNetwork
+
+	mu          sync.Mutex
+	role        int
+	epoch       uint64
+	listener    net.Listener
+	dead        bool
+	partitioned bool // cannot reach anyone, nor be reached
+}
+
+func (n *fakeNode) ID() string       { return n.id }
+func (n *fakeNode) SelfCheck() error { return nil }
+
+func (n *fakeNode) RoleInt() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.role
+}
+
+func (n *fakeNode) Fenced() bool {
+	n.mu.Lock()
+	epoch := n.epoch
+	n.mu.Unlock()
+	n.network.mu.Lock()
+	defer n.network.mu.Unlock()
+	return n.network.epoch > epoch
+}
+
+func (n *fakeNode) BecomeLeader() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.dead {
+		return errors.New("node is dead")
+	}
+	if n.role == RoleLeader {
+		return nil
+	}
+	listener, err := n.network.Listen("tcp", testAddr)
+	if err != nil {
+		return err
+	}
+
+	fn := n.network
+	fn.mu.Lock()
+	fn.epoch++
+	fn.owner = n
+	fn.term = &term{over: make(chan struct{})}
+	n.epoch = fn.epoch
+	fn.mu.Unlock()
+
+	n.listener = listener
+	n.role = RoleLeader
+	return nil
+}
+
+func (n *fakeNode) BecomeFollower() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.role == RoleLeader {
+		n.endTerm(true)
+	}
+	n.role = RoleFollower
+}
+
+// crash kills the node without a handoff
+func (n *fakeNode) crash() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.dead = true
+	if n.role == RoleLeader {
+		n.endTerm(false)
+	}
+	n.role = RoleUnknown
+}
+
+func (n *fakeNode) setPartitioned(p bool) {
+	n.mu.Lock()
+	n.partitioned = p
+	n.mu.Unlock()
+}
+
+func (n *fakeNode) reachable() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return !n.dead && !n.partitioned
+}
+
+// endTerm releases the port, announcing a successor if graceful. Caller
+// must hold n.mu.
+func (n *fakeNode) endTerm(graceful bool) {
+	fn := n.network
+	fn.mu.Lock()
+	t := fn.term
+	if fn.owner == n {
+		fn.owner = nil
+		fn.term = nil
+	}
+	if t != nil {
+		if graceful {
+			event := leader.WatchEvent{Event: leader.EventShutdown, Epoch: n.epoch}
+			for _, id := range t.watchers {
+				if id != n.id {
+					event.Successor = id
+					break
+				}
+			}
+			t.event = &event
+		}
+		close(t.over)
+		fn.clock.mu.Lock()
+		fn.clock.park(-t.waiting)
+		fn.clock.mu.Unlock()
+		t.waiting = 0
+	}
+	fn.mu.Unlock()
+	n.listener.Close()
+}
+
+// fakePinger is one node's view of the leader through the fake network
+type fakePinger struct {
+	self *fakeNode
+}
+
+func (p fakePinger) Live() bool { return true }
+
+func (p fakePinger) leader() (*fakeNode, *term, error) {
+	if !p.self.reachable() {
+		return nil, nil, errors.New("network unreachable")
+	}
+	fn := p.self.network
+	fn.mu.Lock()
+	owner, t := fn.owner, fn.term
+	fn.mu.Unlock()
+	if owner == nil || !owner.reachable() {
+		return nil, nil, errors.New("connection refused")
+	}
+	return owner, t, nil
+}
+
+func (p fakePinger) Ping(ctx context.Context) (leader.PingResponse, error) {
+	owner, _, err := p.leader()
+	if err != nil {
+		return leader.PingResponse{}, err
+	}
+	owner.mu.Lock()
+	defer owner.mu.Unlock()
+	return leader.PingResponse{
+		Status:      "ok",
+		Version:     leader.Version,
+		Protocol:    leader.Protocol,
+		MinProtocol: leader.MinProtocol,
+		Identity:    leader.Identity{ID: owner.id, Epoch: owner.epoch},
+	}, nil
+}
+
+func (p fakePinger) Watch(ctx context.Context, id string) (leader.WatchEvent, error) {
+	_, t, err := p.leader()
+	if err != nil {
+		return leader.WatchEvent{}, err
+	}
+
+	fn := p.self.network
+	fn.mu.Lock()
+	known := false
+	for _, w := range t.watchers {
+		known = known || w == id
+	}
+	if !known {
+		t.watchers = append(t.watchers, id)
+	}
+	select {
+	case <-t.over:
+	default:
+		// endTerm unparks us when it closes t.over
+		t.waiting++
+		fn.clock.mu.Lock()
+		fn.clock.park(1)
+		fn.clock.mu.Unlock()
+	}
+	fn.mu.Unlock()
+
+	select {
+	case <-t.over:
+		fn.mu.Lock()
+		defer fn.mu.Unlock()
+		if t.event == nil {
+			return leader.WatchEvent{}, errors.New("connection reset")
+		}
+		return *t.event, nil
+	case <-ctx.Done():
+		return leader.WatchEvent{}, ctx.Err()
+	}
+}
+
+func (p fakePinger) RequestTakeover(ctx context.Context, req leader.TakeoverRequest) error {
+	return errors.New("not supported by the harness")
+}
+
+// harness is a cluster of in-process nodes sharing one fake clock and network
+type harness struct {
+	t         *testing.T
+	clock     *fakeClock
+	network   *fakeNetwork
+	nodes     []*fakeNode
+	elections []*Election
+}
+
+// newHarness starts n elections at the same instant, all ticking every
+// interval so their checks race each other
+func newHarness(t *testing.T, n int, interval time.Duration) *harness {
+	clock := newFakeClock()
+	h := &harness{t: t, clock: clock, network: newFakeNetwork(clock)}
+	for i := 0; i < n; i++ {
+		node := &fakeNode{id: fmt.Sprintf("node-%d", i), network: h.network}
+		h.nodes = append(h.nodes, node)
+		h.elections = append(h.elections, NewWithOptions(node, Options{
+			Clock:    h.clock,
+			Pinger:   fakePinger{self: node},
+			Interval: func() time.Duration { return interval },
+		}))
+	}
+
+	var wg sync.WaitGroup
+	for _, e := range h.elections {
+		wg.Add(1)
+		go func(e *Election) {
+			defer wg.Done()
+			e.Start()
+		}(e)
+	}
+	wg.Wait()
+	t.Cleanup(h.stop)
+	h.settle()
+	return h
+}
+
+func (h *harness) stop() {
+	for _, e := range h.elections {
+		e.Stop()
+	}
+}
+
+// settle waits until both goroutines of every election, the ticker loop
+// and the watch loop, are blocked again on the clock or a watch
+func (h *harness) settle() {
+	h.t.Helper()
+	want := 2 * len(h.elections)
+	timeout := time.After(10 * time.Second)
+	for h.clock.parkedCount() != want {
+		select {
+		case <-h.clock.changed:
+		case <-timeout:
+			h.t.Fatalf("%d of %d election goroutines blocked; one is stuck", h.clock.parkedCount(), want)
+		}
+	}
+}
+
+// run advances the clock in small steps for d of simulated time
+func (h *harness) run(d time.Duration) {
+	const step = 100 * time.Millisecond
+	h.settle()
+	for elapsed := time.Duration(0); elapsed < d; elapsed += step {
+		h.clock.Advance(step)
+		h.settle()
+	}
+}
+
+// leaders returns the live nodes that believe they lead
+func (h *harness) leaders() []*fakeNode {
+	var list []*fakeNode
+	for _, n := range h.nodes {
+		n.mu.Lock()
+		if !n.dead && n.role == RoleLeader {
+			list = append(list, n)
+		}
+		n.mu.Unlock()
+	}
+	return list
+}
+
+// requireConverged fails unless exactly one live node leads, it holds the
+// port, and every other live node follows
+func (h *harness) requireConverged() *fakeNode {
+	h.t.Helper()
+	leaders := h.leaders()
+	if len(leaders) != 1 {
+		h.t.Fatalf("want exactly one leader, got %d", len(leaders))
+	}
+	h.network.mu.Lock()
+	owner := h.network.owner
+	h.network.mu.Unlock()
+	if owner != leaders[0] {
+		h.t.Fatalf("leader %s does not hold the port", leaders[0].id)
+	}
+	for _, n := range h.nodes {
+		if n != leaders[0] && !n.dead && n.RoleInt() != RoleFollower {
+			h.t.Fatalf("%s is %d, want follower", n.id, n.RoleInt())
+		}
+	}
+	return leaders[0]
+}
+
+func TestStartElectsExactlyOneLeader(t *testing.T) {
+	h := newHarness(t, 5, 3*time.Second)
+	h.run(10 * time.Second)
+	h.requireConverged()
+}
+
+func TestCrashedLeaderIsReplaced(t *testing.T) {
+	h := newHarness(t, 5, 3*time.Second)
+	h.run(5 * time.Second)
+	first := h.requireConverged()
+
+	first.crash()
+	h.run(10 * time.Second)
+	second := h.requireConverged()
+	if second == first {
+		t.Fatal("crashed node is still leader")
+	}
+	if second.epoch <= first.epoch {
+		t.Fatalf("new epoch %d not above %d", second.epoch, first.epoch)
+	}
+}
+
+func TestRepeatedCrashesConverge(t *testing.T) {
+	h := newHarness(t, 5, 3*time.Second)
+	h.run(5 * time.Second)
+	for i := 0; i < 4; i++ {
+		h.requireConverged().crash()
+		h.run(10 * time.Second)
+	}
+	h.requireConverged()
+}
+
+func TestGracefulHandoffGoesToSuccessor(t *testing.T) {
+	h := newHarness(t, 3, 3*time.Second)
+	h.run(5 * time.Second)
+	first := h.requireConverged()
+
+	h.network.mu.Lock()
+	watchers := append([]string(nil), h.network.term.watchers...)
+	h.network.mu.Unlock()
+	if len(watchers) == 0 {
+		t.Fatal("no follower is watching the leader")
+	}
+
+	// Well inside one tick, so only the watch can explain the takeover
+	first.BecomeFollower()
+	h.run(time.Second)
+	if got := h.requireConverged(); got.id != watchers[0] {
+		t.Fatalf("leader is %s, want designated successor %s", got.id, watchers[0])
+	}
+}
+
+func TestPartitionedFollowerCannotSplitBrain(t *testing.T) {
+	h := newHarness(t, 3, 3*time.Second)
+	h.run(5 * time.Second)
+	first := h.requireConverged()
+
+	var cut *fakeNode
+	for _, n := range h.nodes {
+		if n != first {
+			cut = n
+			break
+		}
+	}
+	cut.setPartitioned(true)
+	h.run(10 * time.Second)
+	if got := h.requireConverged(); got != first {
+		t.Fatalf("leadership moved to %s while only a follower was cut off", got.id)
+	}
+
+	cut.setPartitioned(false)
+	h.run(10 * time.Second)
+	h.requireConverged()
+}
+
+func TestHungLeaderKeepsThePort(t *testing.T) {
+	h := newHarness(t, 3, 3*time.Second)
+	h.run(5 * time.Second)
+	first := h.requireConverged()
+
+	// Followers cannot reach the leader, but it still holds the port, so
+	// none of them may claim leadership
+	first.setPartitioned(true)
+	h.run(10 * time.Second)
+	if got := h.requireConverged(); got != first {
+		t.Fatalf("%s took over while %s still held the port", got.id, first.id)
+	}
+
+	first.setPartitioned(false)
+	h.run(5 * time.Second)
+	h.requireConverged()
+}
+
+func TestFakeNetworkWorksAsLeaderListener(t *testing.T) {
+	network := newFakeNetwork(newFakeClock())
+	l := leader.New(testAddr, leader.Options{Listen: network.Listen})
+	if err := l.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Stop()
+
+	if _, err := network.Listen("tcp", testAddr); err == nil {
+		t.Fatal("a second listener bound the leader's address")
+	}
+	if err := leader.New(testAddr, leader.Options{Listen: network.Listen}).Start(); err == nil {
+		t.Fatal("a second leader started on the same address")
+	}
+}
+
+// ledNode is a real node.Node that reports each time it becomes leader
+type ledNode struct {
+	*node.Node
+	led chan struct{}
+}
+
+func (n ledNode) BecomeLeader() error {
+	err := n.Node.BecomeLeader()
+	if err == nil {
+		select {
+		case n.led <- struct{}{}:
+		default:
+		}
+	}
+	return err
+}
+
+// TestRealNodesHandOff runs the election over real nodes, with real leaders
+// on a loopback port and the lockfile, and only the clock faked
+func TestRealNodesHandOff(t *testing.T) {
+	dir := t.TempDir()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	cfg := config.Config{
+		Addr:      addr,
+		LeaderURL: config.BaseURL(addr),
+		Token:     "test-token",
+		Role:      config.RoleAuto,
+		EpochFile: filepath.Join(dir, "epoch"),
+		LockFile:  filepath.Join(dir, "run", "leader.lock"),
+	}
+	clock := newFakeClock()
+	var nodes []ledNode
+	var stops []func()
+	for i := 0; i < 2; i++ {
+		n := ledNode{Node: node.New(cfg), led: make(chan struct{}, 1)}
+		e := NewWithOptions(n, Options{
+			Clock:    clock,
+			Pinger:   NewHTTPPinger(cfg.Locator(), n),
+			Interval: func() time.Duration { return 3 * time.Second },
+		})
+		e.Start()
+		stop := sync.OnceFunc(func() {
+			e.Stop()
+			n.Stop()
+		})
+		t.Cleanup(stop)
+		nodes = append(nodes, n)
+		stops = append(stops, stop)
+	}
+
+	// Start settles the roles before it returns
+	first, second := nodes[0], nodes[1]
+	if first.Role() != node.RoleLeader || second.Role() != node.RoleFollower {
+		t.Fatalf("roles are %s and %s, want LEADER and FOLLOWER", first.Role(), second.Role())
+	}
+	<-first.led
+	firstStatus, err := first.ClusterStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stop the leader, then advance the clock a second whenever the
+	// follower blocks on it, until it takes over: through the handoff if
+	// it was already watching, else on a later check
+	stops[0]()
+	timeout := time.After(10 * time.Second)
+	for second.Role() != node.RoleLeader {
+		select {
+		case <-second.led:
+		case <-clock.changed:
+			clock.Advance(time.Second)
+		case <-timeout:
+			t.Fatalf("follower did not take over, role %s", second.Role())
+		}
+	}
+	status, err := second.ClusterStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Leader.Epoch <= firstStatus.Leader.Epoch {
+		t.Fatalf("new epoch %d not above %d", status.Leader.Epoch, firstStatus.Leader.Epoch)
+	}
+}
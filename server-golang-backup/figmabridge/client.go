@@ -0,0 +1,212 @@
+package figmabridge
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/follower"
+	"figma-mcp-bridge-v2/link"
+	"figma-mcp-bridge-v2/node"
+)
+
+// Subscribe relinks to the leader with backoff between these delays
+const (
+	relinkInitialDelay = 100 * time.Millisecond
+	relinkMaxDelay     = time.Second
+)
+
+// Client calls the bridge leader over the same link followers use. Errors
+// from the bridge are *Error; see CodeOf. A Client is safe for concurrent
+// use.
+type Client struct {
+	follower *follower.Follower
+	timeouts bridge.Timeouts
+}
+
+// NewClient creates a Client for the leader the options point to. It
+// connects on first use.
+func NewClient(opts ...Option) (*Client, error) {
+	cfg, err := newOptions(opts).config()
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		follower: follower.New(cfg.Locator(), "client-"+newID()),
+		timeouts: cfg.Timeouts,
+	}, nil
+}
+
+// Close drops the link to the leader
+func (c *Client) Close() {
+	c.follower.Close()
+}
+
+// Selection returns the nodes selected in Figma
+func (c *Client) Selection(ctx context.Context) ([]Node, error) {
+	var nodes []Node
+	err := c.call(ctx, "get_selection", nil, nil, &nodes)
+	return nodes, err
+}
+
+// Node returns the node with the given ID and its children
+func (c *Client) Node(ctx context.Context, id string) (*Node, error) {
+	var node Node
+	if err := c.call(ctx, "get_node", []string{id}, nil, &node); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// Export renders the node with the given ID as an image or PDF
+func (c *Client) Export(ctx context.Context, id string, opts ExportOptions) (*Export, error) {
+	params := map[string]interface{}{"format": FormatPNG}
+	if opts.Format != "" {
+		params["format"] = opts.Format
+	}
+	if opts.Scale != 0 {
+		params["scale"] = opts.Scale
+	}
+	if opts.OnProgress != nil {
+		ctx = bridge.WithProgress(ctx, func(p bridge.Progress) {
+			opts.OnProgress(Progress(p))
+		})
+	}
+
+	var answer struct {
+		Exports []Export `json:"exports"`
+	}
+	if err := c.call(ctx, "get_screenshot", []string{id}, params, &answer); err != nil {
+		return nil, err
+	}
+	if len(answer.Exports) == 0 {
+		return nil, errors.New("plugin returned no export")
+	}
+	return &answer.Exports[0], nil
+}
+
+// Call sends any plugin request, such as get_variable_defs, and decodes
+// its data into v
+func (c *Client) Call(ctx context.Context, requestType string, nodeIDs []string, params map[string]interface{}, v any) error {
+	return c.call(ctx, requestType, nodeIDs, params, v)
+}
+
+// Status returns the leader's view of the cluster
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	status, err := c.follower.ClusterStatus(ctx)
+	if err != nil {
+		return Status{}, toError(err)
+	}
+	return toStatus(status), nil
+}
+
+// Subscribe delivers bridge events until ctx ends, when the channel is
+// closed. The client stays linked to the leader meanwhile, relinking after
+// a failover. Events are dropped if the channel is not drained.
+func (c *Client) Subscribe(ctx context.Context) (<-chan Event, error) {
+	events, unsubscribe := c.follower.Subscribe()
+	identity, done, err := c.follower.Connect(ctx)
+	if err != nil && !errors.Is(err, follower.ErrLeaderUnavailable) {
+		// A bad token or an incompatible leader will not fix itself
+		unsubscribe()
+		return nil, toError(err)
+	}
+
+	out := make(chan Event, 16)
+	go func() {
+		defer close(out)
+		defer unsubscribe()
+
+		if done != nil {
+			send(out, Event{Type: EventLeader, Epoch: identity.Epoch})
+		}
+		delay := relinkInitialDelay
+		for {
+			if done == nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(delay):
+				}
+				if identity, done, err = c.follower.Connect(ctx); err != nil {
+					delay = min(delay*2, relinkMaxDelay)
+					continue
+				}
+				delay = relinkInitialDelay
+				send(out, Event{Type: EventLeader, Epoch: identity.Epoch})
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-done:
+				done = nil
+			case msg := <-events:
+				send(out, toEvent(msg))
+			}
+		}
+	}()
+	return out, nil
+}
+
+func send(out chan<- Event, event Event) {
+	select {
+	case out <- event:
+	default:
+	}
+}
+
+func toEvent(msg link.Message) Event {
+	var data struct {
+		Connected bool   `json:"connected"`
+		Epoch     uint64 `json:"epoch"`
+	}
+	_ = json.Unmarshal(msg.Data, &data)
+	return Event{Type: msg.Event, Connected: data.Connected, Epoch: data.Epoch}
+}
+
+// call sends a request and decodes its data into v. While the leader is
+// unreachable it retries the way bridge processes do, see node.Retry.
+func (c *Client) call(ctx context.Context, requestType string, nodeIDs []string, params map[string]interface{}, v any) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeouts.For(requestType))
+		defer cancel()
+	}
+
+	resp, err := node.Retry(ctx, requestType, func() (bridge.Response, error) {
+		return c.follower.SendWithParams(ctx, requestType, nodeIDs, params)
+	}, nil)
+	if err != nil {
+		return toError(err)
+	}
+	return decode(resp.Data, v)
+}
+
+// decode converts the plugin's data into v
+func decode(data interface{}, v any) error {
+	if v == nil {
+		return nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("unexpected answer from plugin: %w", err)
+	}
+	return nil
+}
+
+func newID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprint(time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,90 @@
+package figmabridge
+
+import (
+	"context"
+	"errors"
+
+	"figma-mcp-bridge-v2/bridge"
+)
+
+// Code classifies a failed request, with the same values as the error codes
+// of the MCP tools and the REST API
+type Code string
+
+const (
+	// CodeNotConnected means no plugin is there to answer
+	CodeNotConnected Code = "not_connected"
+	// CodeUnavailable means no leader could be reached, e.g. during a
+	// handoff that outlasted the Client's retries
+	CodeUnavailable Code = "unavailable"
+	// CodeTimeout means the plugin did not answer in time
+	CodeTimeout Code = "timeout"
+	// CodeCancelled means the context ended the request
+	CodeCancelled Code = "cancelled"
+	// CodeNodeNotFound means a requested node does not exist or nothing
+	// was selected
+	CodeNodeNotFound Code = "node_not_found"
+	// CodeUnsupported means the plugin does not know the request
+	CodeUnsupported Code = "unsupported"
+	// CodeTooLarge means the answer would be too big to send
+	CodeTooLarge Code = "too_large"
+	// CodePermissionDenied means Figma refused access
+	CodePermissionDenied Code = "permission_denied"
+	// CodeBadRequest means the request itself is malformed
+	CodeBadRequest Code = "bad_request"
+	// CodeNotFound means the REST API has no such path
+	CodeNotFound Code = "not_found"
+	// CodeInternal covers every other failure
+	CodeInternal Code = "internal"
+)
+
+// Error is a request the bridge or the plugin failed. A request ended by
+// its context also matches context.Canceled or context.DeadlineExceeded.
+type Error struct {
+	Code    Code
+	Message string
+	// Retryable reports whether the same request may succeed if sent again
+	Retryable bool
+	// Hint says what to do about the failure, if anything helps
+	Hint string
+
+	err error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// CodeOf returns the code of an *Error in err's chain, or "" if there is
+// none
+func CodeOf(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
+
+// toError converts an error from the bridge into an *Error
+func toError(err error) error {
+	if err == nil {
+		return nil
+	}
+	code := bridge.CodeOf(err)
+	e := &Error{
+		Code:      Code(code),
+		Message:   err.Error(),
+		Retryable: code.Retryable(),
+		Hint:      code.Hint(),
+	}
+	for _, ctxErr := range []error{context.Canceled, context.DeadlineExceeded} {
+		if errors.Is(err, ctxErr) {
+			e.err = ctxErr
+		}
+	}
+	return e
+}
@@ -0,0 +1,188 @@
+package figmabridge
+
+import (
+	"encoding/json"
+	"time"
+
+	"figma-mcp-bridge-v2/leader"
+)
+
+// Node is a Figma node as the plugin serializes it
+type Node struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Bounds is nil for nodes without a position, such as pages
+	Bounds *Bounds `json:"bounds,omitempty"`
+	// Characters is the text of TEXT nodes
+	Characters string         `json:"characters,omitempty"`
+	Styles     map[string]any `json:"styles,omitempty"`
+	Children   []Node         `json:"children,omitempty"`
+	// ChildCount is set instead of Children when they were left out
+	ChildCount int `json:"childCount,omitempty"`
+
+	// Raw is the node as the plugin sent it, including fields not listed
+	// here
+	Raw json.RawMessage `json:"-"`
+}
+
+// Bounds is a node's position and size in its parent, in pixels
+type Bounds struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// UnmarshalJSON decodes a node and keeps its JSON in Raw
+func (n *Node) UnmarshalJSON(data []byte) error {
+	type plain Node
+	var node plain
+	if err := json.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	*n = Node(node)
+	n.Raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// Export formats
+const (
+	FormatPNG = "PNG"
+	FormatJPG = "JPG"
+	FormatSVG = "SVG"
+	FormatPDF = "PDF"
+)
+
+// ExportOptions says how Client.Export renders a node
+type ExportOptions struct {
+	// Format is FormatPNG, FormatJPG, FormatSVG or FormatPDF; PNG if empty
+	Format string
+	// Scale applies to PNG and JPG; the plugin's default of 2 if zero
+	Scale float64
+	// OnProgress, if set, is called as the plugin reports progress
+	OnProgress func(Progress)
+}
+
+// Progress is how far the plugin got with a request
+type Progress struct {
+	Progress float64
+	// Total is zero when unknown
+	Total   float64
+	Message string
+}
+
+// Export is a node rendered by the plugin
+type Export struct {
+	NodeID   string  `json:"nodeId"`
+	NodeName string  `json:"nodeName"`
+	Format   string  `json:"format"`
+	Width    float64 `json:"width"`
+	Height   float64 `json:"height"`
+	// Data is the PNG, JPG, SVG or PDF file
+	Data []byte `json:"base64"`
+}
+
+// Event kinds delivered by Client.Subscribe
+const (
+	// EventLeader means the client linked to a leader, when subscribing
+	// and again after a failover; Epoch identifies the leader
+	EventLeader = "leader"
+	// EventPlugin means the Figma plugin connected or disconnected, see
+	// Connected
+	EventPlugin = "plugin"
+	// EventShutdown means the leader is handing off to another process;
+	// an EventLeader follows once the client reaches it
+	EventShutdown = "shutdown"
+)
+
+// Event is something that happened to the bridge
+type Event struct {
+	Type      string
+	Connected bool
+	Epoch     uint64
+}
+
+// Status is the leader's view of the cluster
+type Status struct {
+	Leader LeaderStatus
+	Plugin PluginStatus
+	// PendingRequests counts requests the plugin has not answered yet
+	PendingRequests int
+	Followers       []FollowerStatus
+}
+
+// LeaderStatus describes the leading process
+type LeaderStatus struct {
+	ID        string
+	Epoch     uint64
+	PID       int
+	Version   string
+	Addr      string
+	StartedAt time.Time
+	// Clients are the MCP clients connected to the leader itself
+	Clients []string
+}
+
+// PluginStatus describes the leader's connection to the Figma plugin
+type PluginStatus struct {
+	Connected bool
+	// Since is when the plugin connected, or last disconnected
+	Since time.Time
+	// Timeouts counts requests in a row the plugin did not answer in time
+	Timeouts int
+	// Relay is set when the plugin reaches the leader through a relay
+	Relay bool
+	// Replay is set when answers come from a recorded session
+	Replay bool
+}
+
+// FollowerStatus describes a bridge process forwarding to the leader
+type FollowerStatus struct {
+	ID       string
+	PID      int
+	Client   string
+	Version  string
+	LastSeen time.Time
+	Requests uint64
+	Errors   uint64
+}
+
+func toStatus(s leader.ClusterStatus) Status {
+	status := Status{
+		Leader: LeaderStatus{
+			ID:        s.Leader.ID,
+			Epoch:     s.Leader.Epoch,
+			PID:       s.Leader.PID,
+			Version:   s.Leader.Version,
+			Addr:      s.Leader.Addr,
+			StartedAt: s.Leader.StartedAt,
+			Clients:   s.Leader.Clients,
+		},
+		Plugin: PluginStatus{
+			Connected: s.Plugin.Connected,
+			Timeouts:  s.Plugin.Timeouts,
+			Relay:     s.Plugin.Relay,
+			Replay:    s.Plugin.Replay,
+		},
+		PendingRequests: s.PendingRequests,
+	}
+	switch {
+	case s.Plugin.ConnectedAt != nil:
+		status.Plugin.Since = *s.Plugin.ConnectedAt
+	case s.Plugin.DisconnectedSince != nil:
+		status.Plugin.Since = *s.Plugin.DisconnectedSince
+	}
+	for _, f := range s.Followers {
+		status.Followers = append(status.Followers, FollowerStatus{
+			ID:       f.ID,
+			PID:      f.PID,
+			Client:   f.Client,
+			Version:  f.Version,
+			LastSeen: f.LastSeen,
+			Requests: f.Requests,
+			Errors:   f.Errors,
+		})
+	}
+	return status
+}
@@ -0,0 +1,127 @@
+// Package figmabridge lets Go programs in this module use the bridge without
+// its command line. A Client reads the Figma file open in the plugin through
+// whichever bridge process leads, finding it, authenticating and following
+// failovers the same way the figma-bridge followers do:
+//
+//	c, err := figmabridge.NewClient()
+//	if err != nil { ... }
+//	defer c.Close()
+//	nodes, err := c.Selection(ctx)
+//
+// A Server runs a bridge node inside the program, taking part in the
+// election and serving the MCP tools, as figma-bridge does.
+//
+// The package only exposes its own types, so its API does not change with
+// the bridge's internals. The module path is not fetchable; programs
+// outside this repository need a replace directive pointing at a checkout.
+package figmabridge
+
+import (
+	"flag"
+	"io"
+	"maps"
+	"path/filepath"
+	"time"
+
+	"figma-mcp-bridge-v2/config"
+)
+
+// Option configures a Client or a Server. Without options both load the
+// configuration like figma-bridge without flags: from the config file and
+// the FIGMA_BRIDGE_* environment variables.
+type Option func(*options)
+
+type options struct {
+	args     []string
+	timeouts map[string]time.Duration
+	stateDir string
+	http     bool
+}
+
+// WithProfile selects a profile from the config file
+func WithProfile(name string) Option {
+	return withFlag("profile", name)
+}
+
+// WithLeaderURL talks to the leader at url, e.g. a remote one, instead of
+// looking for a local one
+func WithLeaderURL(url string) Option {
+	return withFlag("leader-url", url)
+}
+
+// WithToken sets the shared secret instead of reading the token file
+func WithToken(token string) Option {
+	return withFlag("token", token)
+}
+
+// WithAddr sets the address a Server listens on when it leads
+func WithAddr(addr string) Option {
+	return withFlag("addr", addr)
+}
+
+// WithRole pins a Server to RoleLeader or RoleFollower instead of taking
+// part in the election
+func WithRole(role Role) Option {
+	return withFlag("role", string(role))
+}
+
+// WithTimeouts overrides how long requests wait for the plugin, by request
+// type
+func WithTimeouts(t map[string]time.Duration) Option {
+	return func(o *options) {
+		if o.timeouts == nil {
+			o.timeouts = make(map[string]time.Duration)
+		}
+		maps.Copy(o.timeouts, t)
+	}
+}
+
+// WithStateDir keeps the leader lockfile and epoch in dir instead of the
+// per-user defaults, so a Server can run a cluster of its own. dir must be
+// private to the user, like the default runtime directory.
+func WithStateDir(dir string) Option {
+	return func(o *options) { o.stateDir = dir }
+}
+
+// WithMCPOverHTTP makes a Server expose MCP over streamable HTTP at /mcp
+// whenever it leads
+func WithMCPOverHTTP() Option {
+	return func(o *options) { o.http = true }
+}
+
+func withFlag(name, value string) Option {
+	return func(o *options) { o.args = append(o.args, "-"+name+"="+value) }
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// config resolves the configuration the options describe
+func (o options) config() (config.Config, error) {
+	fs := flag.NewFlagSet("figmabridge", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	flags := config.RegisterFlags(fs)
+	if err := fs.Parse(o.args); err != nil {
+		return config.Config{}, err
+	}
+	cfg, err := flags.Load()
+	if err != nil {
+		return config.Config{}, err
+	}
+	if len(o.timeouts) > 0 {
+		if cfg.Timeouts == nil {
+			cfg.Timeouts = make(map[string]time.Duration)
+		}
+		maps.Copy(cfg.Timeouts, o.timeouts)
+	}
+	if o.stateDir != "" {
+		cfg.EpochFile = filepath.Join(o.stateDir, "epoch")
+		cfg.LockFile = filepath.Join(o.stateDir, "leader.lock")
+	}
+	return cfg, nil
+}
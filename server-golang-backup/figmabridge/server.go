@@ -0,0 +1,80 @@
+package figmabridge
+
+import (
+	"context"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"figma-mcp-bridge-v2/node"
+	"figma-mcp-bridge-v2/server"
+)
+
+// Role is what a Server does in the cluster
+type Role string
+
+const (
+	// RoleAuto takes part in the election; only for WithRole
+	RoleAuto Role = "auto"
+	// RoleLeader owns the plugin connection and serves the other processes
+	RoleLeader Role = "leader"
+	// RoleFollower forwards requests to the leader
+	RoleFollower Role = "follower"
+)
+
+// Server is a bridge node with the MCP tools registered on an MCP server.
+// It leads or follows like any figma-bridge process sharing its
+// configuration; MCP clients of either role reach the plugin.
+type Server struct {
+	server *server.Server
+}
+
+// NewServer creates a Server from the options. Call Start, or Run, to join
+// the cluster, and connect MCP clients through MCPServer.
+func NewServer(opts ...Option) (*Server, error) {
+	o := newOptions(opts)
+	cfg, err := o.config()
+	if err != nil {
+		return nil, err
+	}
+	return &Server{server: server.New(cfg, o.http)}, nil
+}
+
+// MCPServer returns the MCP server with the bridge's tools, e.g. to run it
+// over stdio
+func (s *Server) MCPServer() *mcp.Server {
+	return s.server.MCPServer()
+}
+
+// Role returns RoleLeader or RoleFollower, or "" until Start has settled
+// the role
+func (s *Server) Role() Role {
+	switch s.server.Role() {
+	case node.RoleLeader:
+		return RoleLeader
+	case node.RoleFollower:
+		return RoleFollower
+	}
+	return ""
+}
+
+// Start takes the configured role: it joins the election, or leads or
+// follows unconditionally when pinned with WithRole. A server pinned to
+// lead fails if it cannot.
+func (s *Server) Start() error {
+	return s.server.Start()
+}
+
+// Stop leaves the cluster, handing off to a follower if this server leads
+func (s *Server) Stop() {
+	s.server.Stop()
+}
+
+// Run starts the server and stops it when ctx ends
+func (s *Server) Run(ctx context.Context) error {
+	if err := s.Start(); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	s.Stop()
+	return nil
+}
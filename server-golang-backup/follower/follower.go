@@ -1,43 +1,64 @@
 package follower
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"sync"
 	"time"
 
 	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/discovery"
+	"figma-mcp-bridge-v2/leader"
+	"figma-mcp-bridge-v2/link"
 )
 
-// RPCRequest is the format for outgoing RPC requests to the leader
-type RPCRequest struct {
-	Tool    string                 `json:"tool"`
-	NodeIDs []string               `json:"nodeIds,omitempty"`
-	Params  map[string]interface{} `json:"params,omitempty"`
-}
+// ErrLeaderUnavailable means no leader could be reached, so the request was
+// never sent and can safely be retried
+var ErrLeaderUnavailable = &bridge.Error{Code: bridge.CodeUnavailable, Message: "leader unavailable"}
 
-// RPCResponse is the format for RPC responses from the leader
-type RPCResponse struct {
-	Data  json.RawMessage `json:"data,omitempty"`
-	Error string          `json:"error,omitempty"`
-}
+var errBadToken = errors.New("leader rejected our token; check the token file or -token")
 
-// Follower proxies MCP tool calls to the leader via HTTP
+// Follower proxies MCP tool calls to the leader over a persistent WebSocket
+// link, reconnecting to whichever node leads when the link drops
 type Follower struct {
-	leaderURL string
-	client    *http.Client
+	locator discovery.Locator
+	nodeID  string
+	client  *http.Client
+
+	mu        sync.Mutex
+	leader    leader.Identity // last verified leader, zero if unknown
+	target    target          // where the verified leader was found
+	seenEpoch uint64          // highest epoch ever observed
+
+	linkMu sync.Mutex
+	link   *linkConn
+
+	subMu       sync.Mutex
+	subscribers map[chan link.Message]struct{}
+}
+
+// target is a leader's base URL and the token it expects
+type target struct {
+	url   string
+	token string
 }
 
-// New creates a new Follower instance
-func New(leaderURL string) *Follower {
+// New creates a new Follower that finds the leader with locator and
+// identifies itself as nodeID
+func New(locator discovery.Locator, nodeID string) *Follower {
 	return &Follower{
-		leaderURL: leaderURL,
+		locator: locator,
+		nodeID:  nodeID,
+		// Tool calls go over the link; this client only probes and
+		// reports, which should be quick
 		client: &http.Client{
-			Timeout: 35 * time.Second, // Slightly longer than leader's timeout
+			Timeout: 10 * time.Second,
 		},
+		subscribers: make(map[chan link.Message]struct{}),
 	}
 }
 
@@ -46,70 +67,256 @@ func (f *Follower) Send(ctx context.Context, requestType string, nodeIDs []strin
 	return f.SendWithParams(ctx, requestType, nodeIDs, nil)
 }
 
-// SendWithParams proxies a request with parameters to the leader
+// SeenEpoch returns the highest leader epoch this follower has observed
+func (f *Follower) SeenEpoch() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.seenEpoch
+}
+
+// SendWithParams proxies a request with parameters to the leader. It makes a
+// single attempt: failures to reach the leader wrap ErrLeaderUnavailable and
+// a link dropped mid-call yields ErrLeaderLost, leaving retries to the caller.
 func (f *Follower) SendWithParams(ctx context.Context, requestType string, nodeIDs []string, params map[string]interface{}) (bridge.Response, error) {
-	rpcReq := RPCRequest{
-		Tool:    requestType,
-		NodeIDs: nodeIDs,
-		Params:  params,
+	lc, err := f.getLink(ctx)
+	if err != nil {
+		return bridge.Response{}, err
 	}
+	return lc.call(ctx, requestType, nodeIDs, params)
+}
 
-	body, err := json.Marshal(rpcReq)
-	if err != nil {
-		return bridge.Response{}, fmt.Errorf("failed to marshal RPC request: %w", err)
+// Subscribe returns a channel receiving the events the leader pushes over
+// the link, and a function to unsubscribe. Slow subscribers miss events.
+func (f *Follower) Subscribe() (<-chan link.Message, func()) {
+	ch := make(chan link.Message, 16)
+	f.subMu.Lock()
+	f.subscribers[ch] = struct{}{}
+	f.subMu.Unlock()
+
+	return ch, func() {
+		f.subMu.Lock()
+		if _, ok := f.subscribers[ch]; ok {
+			delete(f.subscribers, ch)
+			close(ch)
+		}
+		f.subMu.Unlock()
 	}
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.leaderURL+"/rpc", bytes.NewReader(body))
+// Connect opens the link to the leader unless it is open already, so events
+// reach subscribers before any request is sent. It returns the leader's
+// identity and a channel closed when the link drops.
+func (f *Follower) Connect(ctx context.Context) (leader.Identity, <-chan struct{}, error) {
+	lc, err := f.getLink(ctx)
 	if err != nil {
-		return bridge.Response{}, fmt.Errorf("failed to create request: %w", err)
+		return leader.Identity{}, nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
+	return lc.identity, lc.done, nil
+}
 
-	resp, err := f.client.Do(req)
-	if err != nil {
-		return bridge.Response{}, fmt.Errorf("failed to call leader: %w", err)
+func (f *Follower) dispatchEvent(msg link.Message) {
+	f.subMu.Lock()
+	defer f.subMu.Unlock()
+	for ch := range f.subscribers {
+		select {
+		case ch <- msg:
+		default:
+		}
 	}
-	defer resp.Body.Close()
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return bridge.Response{}, fmt.Errorf("leader returned status %d", resp.StatusCode)
+// Close drops the link to the leader
+func (f *Follower) Close() {
+	f.linkMu.Lock()
+	defer f.linkMu.Unlock()
+	if f.link != nil {
+		f.link.close()
+		f.link = nil
 	}
+}
 
-	var rpcResp RPCResponse
-	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
-		return bridge.Response{}, fmt.Errorf("failed to decode response: %w", err)
+// getLink returns the open link to the leader, establishing a new one if
+// needed. Probing and dialing happen without linkMu, so a slow leader does
+// not hold up callers; if two dial at once, the first link wins.
+func (f *Follower) getLink(ctx context.Context) (*linkConn, error) {
+	if lc := f.liveLink(); lc != nil {
+		return lc, nil
 	}
 
-	if rpcResp.Error != "" {
-		return bridge.Response{Error: rpcResp.Error}, errors.New(rpcResp.Error)
+	for attempt := 0; ; attempt++ {
+		identity, t, err := f.verifiedLeader(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrLeaderUnavailable, err)
+		}
+
+		lc, err := f.dialLink(ctx, t, identity)
+		if err == nil {
+			f.linkMu.Lock()
+			defer f.linkMu.Unlock()
+			if f.link != nil && f.link.alive() {
+				lc.close()
+				return f.link, nil
+			}
+			f.link = lc
+			return lc, nil
+		}
+		if errors.Is(err, errBadToken) || errors.Is(err, leader.ErrIncompatible) {
+			return nil, err
+		}
+		f.forgetLeader()
+		if errors.Is(err, errStaleEpoch) && attempt == 0 {
+			// A new leader took over since we last probed; verify it and
+			// dial again
+			continue
+		}
+		return nil, fmt.Errorf("%w: %v", ErrLeaderUnavailable, err)
 	}
+}
 
-	// Unmarshal the raw JSON data into interface{}
-	var data interface{}
-	if len(rpcResp.Data) > 0 {
-		if err := json.Unmarshal(rpcResp.Data, &data); err != nil {
-			return bridge.Response{}, fmt.Errorf("failed to unmarshal data: %w", err)
+// liveLink returns the open link to the leader, or nil
+func (f *Follower) liveLink() *linkConn {
+	f.linkMu.Lock()
+	defer f.linkMu.Unlock()
+	if f.link != nil && f.link.alive() {
+		return f.link
+	}
+	f.link = nil
+	return nil
+}
+
+// Heartbeat registers this follower with the leader or refreshes its entry.
+// It goes over the link, opening it if needed, so a follower sending
+// heartbeats is also watching for the leader's handoff.
+func (f *Follower) Heartbeat(ctx context.Context, client string) error {
+	lc, err := f.getLink(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(leader.Heartbeat{
+		ID:      f.nodeID,
+		PID:     os.Getpid(),
+		Client:  client,
+		Version: leader.Version,
+	})
+	if err != nil {
+		return err
+	}
+	if err := lc.send(link.Message{Kind: link.KindHeartbeat, Data: data}); err != nil {
+		lc.close()
+		return ErrLeaderLost
+	}
+	return nil
+}
+
+// Watch waits on the link for the leader to announce its handoff, opening
+// the link if needed. It fails with ErrLeaderLost if the link drops without
+// an announcement.
+func (f *Follower) Watch(ctx context.Context) (leader.WatchEvent, error) {
+	events, unsubscribe := f.Subscribe()
+	defer unsubscribe()
+	_, done, err := f.Connect(ctx)
+	if err != nil {
+		return leader.WatchEvent{}, err
+	}
+
+	for {
+		select {
+		case msg := <-events:
+			if event, ok := shutdownEvent(msg); ok {
+				return event, nil
+			}
+		case <-done:
+			// The leader announces the handoff right before closing the
+			// link, and the event is queued before done closes
+			for {
+				select {
+				case msg := <-events:
+					if event, ok := shutdownEvent(msg); ok {
+						return event, nil
+					}
+				default:
+					return leader.WatchEvent{}, ErrLeaderLost
+				}
+			}
+		case <-ctx.Done():
+			return leader.WatchEvent{}, ctx.Err()
 		}
 	}
+}
+
+// shutdownEvent decodes the leader's handoff announcement
+func shutdownEvent(msg link.Message) (leader.WatchEvent, bool) {
+	var event leader.WatchEvent
+	if msg.Event != link.EventShutdown || json.Unmarshal(msg.Data, &event) != nil {
+		return leader.WatchEvent{}, false
+	}
+	return event, true
+}
 
-	return bridge.Response{
-		Type: requestType,
-		Data: data,
-	}, nil
+// ClusterStatus fetches the leader's view of the cluster
+func (f *Follower) ClusterStatus(ctx context.Context) (leader.ClusterStatus, error) {
+	url, token := f.locator.Leader()
+	return leader.FetchClusterStatus(ctx, f.client, url, token)
 }
 
-// Ping checks if the leader is reachable and healthy
+// Ping checks if the leader is reachable and proves it shares our token
 func (f *Follower) Ping(ctx context.Context) bool {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.leaderURL+"/ping", nil)
+	_, err := f.probe(ctx)
+	return err == nil
+}
+
+// verifiedLeader returns the identity of the current leader, probing it if
+// we have not verified one yet
+func (f *Follower) verifiedLeader(ctx context.Context) (leader.Identity, target, error) {
+	f.mu.Lock()
+	identity, t := f.leader, f.target
+	f.mu.Unlock()
+	if identity.ID != "" {
+		return identity, t, nil
+	}
+
+	identity, err := f.probe(ctx)
 	if err != nil {
-		return false
+		return leader.Identity{}, target{}, fmt.Errorf("failed to verify leader: %w", err)
 	}
+	f.mu.Lock()
+	t = f.target
+	f.mu.Unlock()
+	return identity, t, nil
+}
 
-	resp, err := f.client.Do(req)
+func (f *Follower) probe(ctx context.Context) (leader.Identity, error) {
+	url, token := f.locator.Leader()
+	ping, err := leader.Probe(ctx, f.client, url, token)
 	if err != nil {
-		return false
+		f.forgetLeader()
+		return leader.Identity{}, err
+	}
+
+	if !ping.Compatible() {
+		// Refuse to send it anything; a newer node will take over from
+		// an outdated leader, see Election
+		f.forgetLeader()
+		return leader.Identity{}, fmt.Errorf("%w: leader runs %s (protocol %d-%d), we run %s (protocol %d-%d)", leader.ErrIncompatible,
+			ping.Version, ping.MinProtocol, ping.Protocol, leader.Version, leader.MinProtocol, leader.Protocol)
 	}
-	defer resp.Body.Close()
 
-	return resp.StatusCode == http.StatusOK
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if ping.Epoch < f.seenEpoch {
+		// A leader older than one we already followed is a stale process
+		// that has not noticed it was superseded
+		f.leader = leader.Identity{}
+		return leader.Identity{}, fmt.Errorf("leader epoch %d is older than %d", ping.Epoch, f.seenEpoch)
+	}
+	f.leader = ping.Identity
+	f.target = target{url: url, token: token}
+	f.seenEpoch = ping.Epoch
+	return ping.Identity, nil
+}
+
+func (f *Follower) forgetLeader() {
+	f.mu.Lock()
+	f.leader = leader.Identity{}
+	f.mu.Unlock()
 }
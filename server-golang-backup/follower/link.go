@@ -0,0 +1,229 @@
+package follower
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/leader"
+	"figma-mcp-bridge-v2/link"
+	"figma-mcp-bridge-v2/trace"
+)
+
+// errStaleEpoch means the leader we dialed is not the one we verified
+var errStaleEpoch = errors.New("leader epoch changed")
+
+// ErrLeaderLost is returned for calls in flight when the link drops, which
+// usually means the leader went away and a new one is being elected. The
+// leader may or may not have executed the request.
+var ErrLeaderLost = &bridge.Error{Code: bridge.CodeUnavailable, Message: "lost connection to leader"}
+
+// linkConn is the follower's end of the persistent WebSocket to the leader.
+// Requests are multiplexed by ID; events are handed to onEvent.
+type linkConn struct {
+	conn     *websocket.Conn
+	identity leader.Identity
+	writeMu  sync.Mutex
+	onEvent  func(link.Message)
+
+	mu      sync.Mutex
+	pending map[string]*linkCall
+	closed  bool
+	done    chan struct{}
+}
+
+// linkCall is a request waiting for its response
+type linkCall struct {
+	ch       chan link.Message
+	progress func(bridge.Progress)
+}
+
+var requestCounter uint64
+
+// dialLink opens a link to the leader with the given identity at t
+func (f *Follower) dialLink(ctx context.Context, t target, identity leader.Identity) (*linkConn, error) {
+	wsURL := "ws" + strings.TrimPrefix(t.url, "http") + link.Path
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+t.token)
+	header.Set(leader.EpochHeader, strconv.FormatUint(identity.Epoch, 10))
+	header.Set(leader.NodeHeader, f.nodeID)
+	header.Set(leader.ProtocolHeader, strconv.Itoa(leader.Protocol))
+
+	dialer := websocket.Dialer{HandshakeTimeout: 5 * time.Second}
+	conn, resp, err := dialer.DialContext(ctx, wsURL, header)
+	if err != nil {
+		if resp != nil {
+			switch resp.StatusCode {
+			case http.StatusConflict:
+				return nil, errStaleEpoch
+			case http.StatusUnauthorized:
+				return nil, errBadToken
+			case http.StatusUpgradeRequired:
+				return nil, fmt.Errorf("%w: leader no longer speaks protocol %d", leader.ErrIncompatible, leader.Protocol)
+			}
+		}
+		return nil, fmt.Errorf("failed to connect to leader: %w", err)
+	}
+
+	lc := &linkConn{
+		conn:     conn,
+		identity: identity,
+		onEvent:  f.dispatchEvent,
+		pending:  make(map[string]*linkCall),
+		done:     make(chan struct{}),
+	}
+	link.KeepAlive(conn, lc.done)
+	go lc.readLoop()
+	return lc, nil
+}
+
+func (lc *linkConn) readLoop() {
+	defer lc.close()
+	for {
+		var msg link.Message
+		if err := lc.conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		switch msg.Kind {
+		case link.KindResponse:
+			lc.mu.Lock()
+			c := lc.pending[msg.ID]
+			delete(lc.pending, msg.ID)
+			lc.mu.Unlock()
+			if c != nil {
+				c.ch <- msg
+			}
+		case link.KindProgress:
+			lc.mu.Lock()
+			c := lc.pending[msg.ID]
+			lc.mu.Unlock()
+			var p bridge.Progress
+			if c != nil && c.progress != nil && json.Unmarshal(msg.Data, &p) == nil {
+				c.progress(p)
+			}
+		case link.KindEvent:
+			lc.onEvent(msg)
+		}
+	}
+}
+
+// close fails every pending call with ErrLeaderLost
+func (lc *linkConn) close() {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if lc.closed {
+		return
+	}
+	lc.closed = true
+	close(lc.done)
+	lc.conn.Close()
+	for id, c := range lc.pending {
+		close(c.ch)
+		delete(lc.pending, id)
+	}
+}
+
+func (lc *linkConn) alive() bool {
+	select {
+	case <-lc.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (lc *linkConn) send(msg link.Message) error {
+	lc.writeMu.Lock()
+	defer lc.writeMu.Unlock()
+	_ = lc.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return lc.conn.WriteJSON(msg)
+}
+
+// call sends a request and waits for its response. If ctx ends first the
+// leader is told to cancel the request.
+func (lc *linkConn) call(ctx context.Context, requestType string, nodeIDs []string, params map[string]interface{}) (resp bridge.Response, err error) {
+	ctx, span := trace.Start(ctx, "forward "+requestType, trace.KindClient)
+	defer func() { span.End(err) }()
+
+	id := "f-" + strconv.FormatUint(atomic.AddUint64(&requestCounter, 1), 10)
+	ch := make(chan link.Message, 1)
+	progress, stopProgress := bridge.AsyncProgress(bridge.ProgressFrom(ctx))
+	defer stopProgress()
+
+	lc.mu.Lock()
+	if lc.closed {
+		lc.mu.Unlock()
+		return bridge.Response{}, ErrLeaderLost
+	}
+	lc.pending[id] = &linkCall{ch: ch, progress: progress}
+	lc.mu.Unlock()
+
+	err = lc.send(link.Message{
+		Kind:      link.KindRequest,
+		ID:        id,
+		Tool:      requestType,
+		NodeIDs:   nodeIDs,
+		Params:    params,
+		Session:   bridge.OriginFrom(ctx).Session,
+		TraceID:   span.Context().TraceID,
+		SpanID:    span.Context().SpanID,
+		TimeoutMs: bridge.TimeoutMillis(ctx),
+	})
+	if err != nil {
+		lc.close()
+		return bridge.Response{}, ErrLeaderLost
+	}
+
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return bridge.Response{}, ErrLeaderLost
+		}
+		if msg.Timing != nil {
+			span.SetAttr("figma_bridge.leader_ms", msg.Timing.LeaderMs)
+			span.SetAttr("figma_bridge.plugin_ms", msg.Timing.PluginMs)
+		}
+		return decodeResponse(requestType, msg)
+	case <-ctx.Done():
+		lc.mu.Lock()
+		delete(lc.pending, id)
+		lc.mu.Unlock()
+		_ = lc.send(link.Message{Kind: link.KindCancel, ID: id})
+		return bridge.Response{}, ctx.Err()
+	}
+}
+
+func decodeResponse(requestType string, msg link.Message) (bridge.Response, error) {
+	if msg.Error == link.ErrDraining || strings.HasPrefix(msg.Error, link.ErrSuperseded) {
+		// Refused before it ran, so it is safe to send again
+		return bridge.Response{}, fmt.Errorf("%w: %s", ErrLeaderUnavailable, msg.Error)
+	}
+	if msg.Error != "" {
+		err := bridge.NewError(bridge.Code(msg.Code), msg.Error)
+		return bridge.Response{Error: msg.Error, Code: err.Code}, err
+	}
+
+	// Unmarshal the raw JSON data into interface{}
+	var data interface{}
+	if len(msg.Data) > 0 {
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			return bridge.Response{}, fmt.Errorf("failed to unmarshal data: %w", err)
+		}
+	}
+
+	return bridge.Response{
+		Type: requestType,
+		Data: data,
+	}, nil
+}
@@ -0,0 +1,237 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/link"
+)
+
+const (
+	// How long Stop waits for in-flight requests before handing off anyway
+	drainTimeout = 5 * time.Second
+	// How long a /watch long-poll is held before returning EventNone
+	watchTimeout = 25 * time.Second
+	// A follower that has not watched for this long is gone and loses its
+	// place in the succession
+	watcherExpiry = 2 * watchTimeout
+	// retryAfter is the Retry-After sent with requests refused while
+	// draining; the successor binds the port within about a second
+	retryAfter = "1"
+)
+
+// errDraining refuses new requests during a handoff. They never ran, so
+// callers can send them again to the successor.
+var errDraining = &bridge.Error{Code: bridge.CodeUnavailable, Message: link.ErrDraining}
+
+// Events delivered to followers on the link, or through /watch to
+// followers from before the link carried them
+const (
+	EventNone     = "none"
+	EventShutdown = "shutdown"
+)
+
+// WatchEvent announces a handoff on the link, and answers a /watch
+// long-poll
+type WatchEvent struct {
+	Event string `json:"event"`
+	// Successor is the node ID of the follower that should bind the port
+	// immediately; other followers wait briefly before competing
+	Successor string `json:"successor,omitempty"`
+	Epoch     uint64 `json:"epoch"`
+}
+
+// watchers tracks followers with an open link or blocked in /watch, in the
+// order they first started watching, so the longest-lived follower becomes
+// the successor. A link watches until it closes; /watch followers poll
+// again after every answer, so one stays in order between polls until it
+// disconnects mid-poll or stops polling for watcherExpiry.
+type watchers struct {
+	mu      sync.Mutex
+	order   []string
+	seen    map[string]time.Time
+	waiting map[string]chan WatchEvent
+	closed  bool
+	final   WatchEvent
+}
+
+func newWatchers() *watchers {
+	return &watchers{
+		seen:    make(map[string]time.Time),
+		waiting: make(map[string]chan WatchEvent),
+	}
+}
+
+// add registers a waiting follower. It returns nil if the leader is already
+// handing off, in which case the final event is returned instead.
+func (w *watchers) add(id string) (chan WatchEvent, *WatchEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		final := w.final
+		return nil, &final
+	}
+	w.expire(time.Now())
+	ch := make(chan WatchEvent, 1)
+	if _, known := w.seen[id]; !known {
+		w.order = append(w.order, id)
+	}
+	w.seen[id] = time.Now()
+	w.waiting[id] = ch
+	return ch, nil
+}
+
+// remove ends a poll that timed out; the follower keeps its place
+func (w *watchers) remove(id string, ch chan WatchEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.waiting[id] == ch {
+		delete(w.waiting, id)
+		w.seen[id] = time.Now()
+	}
+}
+
+// forget drops a follower that disconnected mid-poll from the succession
+func (w *watchers) forget(id string, ch chan WatchEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.waiting[id] == ch {
+		delete(w.waiting, id)
+		w.drop(id)
+	}
+}
+
+// expire drops followers that stopped polling. Caller must hold w.mu.
+func (w *watchers) expire(now time.Time) {
+	for id, seen := range w.seen {
+		if _, ok := w.waiting[id]; !ok && now.Sub(seen) > watcherExpiry {
+			w.drop(id)
+		}
+	}
+}
+
+// drop removes id from the succession. Caller must hold w.mu.
+func (w *watchers) drop(id string) {
+	delete(w.seen, id)
+	w.order = slices.DeleteFunc(w.order, func(v string) bool { return v == id })
+}
+
+// successor picks the longest-watching follower that is still connected
+func (w *watchers) successor() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, id := range w.order {
+		if _, ok := w.waiting[id]; ok {
+			return id
+		}
+	}
+	return ""
+}
+
+// broadcast sends the final event to every watcher and makes later watches
+// return it immediately
+func (w *watchers) broadcast(event WatchEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	w.final = event
+	for id, ch := range w.waiting {
+		ch <- event
+		delete(w.waiting, id)
+	}
+}
+
+// handleWatch holds a follower's request open until the leader hands off or
+// watchTimeout elapses. Current followers watch on the link instead.
+func (l *Leader) handleWatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	event := WatchEvent{Event: EventNone, Epoch: l.identity.Epoch}
+	ch, final := l.watchers.add(id)
+	if final != nil {
+		event = *final
+	} else {
+		timer := time.NewTimer(watchTimeout)
+		defer timer.Stop()
+		select {
+		case event = <-ch:
+		case <-timer.C:
+			l.watchers.remove(id, ch)
+		case <-r.Context().Done():
+			l.watchers.forget(id, ch)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(event)
+}
+
+// handOff stops taking new work, waits for in-flight requests to finish,
+// tells followers who takes over and asks the plugin to reconnect
+func (l *Leader) handOff() {
+	l.draining.Store(true)
+
+	deadline := time.Now().Add(drainTimeout)
+	for l.inflight.Load() > 0 || l.bridge.PendingCount() > 0 {
+		if time.Now().After(deadline) {
+			log.Printf("Handing off with %d request(s) still in flight", l.inflight.Load()+int64(l.bridge.PendingCount()))
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	successor := l.watchers.successor()
+	if id := l.takeoverBy.Load(); id != nil {
+		// A newer node asked for leadership; it gets the port first
+		successor = *id
+	}
+	event := WatchEvent{
+		Event:     EventShutdown,
+		Successor: successor,
+		Epoch:     l.identity.Epoch,
+	}
+	l.watchers.broadcast(event)
+	l.links.broadcast(link.EventShutdown, event)
+	if successor != "" {
+		log.Printf("Handing leadership to %s", successor)
+	}
+
+	l.bridge.CloseForRestart("leader handoff")
+	l.relay.CloseForRestart(event)
+	l.links.closeAll()
+}
+
+// trackRPC counts in-flight RPCs so handoff can wait for them. The handler
+// itself refuses new work once handoff started, in its own format.
+func (l *Leader) trackRPC(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l.inflight.Add(1)
+		defer l.inflight.Add(-1)
+		next(w, r)
+	}
+}
+
+// shutdownServer closes the HTTP server after the handoff
+func (l *Leader) shutdownServer() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := l.server.Shutdown(ctx); err != nil {
+		log.Printf("Leader shutdown error: %v", err)
+	}
+}
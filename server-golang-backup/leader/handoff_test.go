@@ -0,0 +1,36 @@
+package leader
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWatchersForgetGoneFollowers(t *testing.T) {
+	w := newWatchers()
+	a, _ := w.add("a")
+	b, _ := w.add("b")
+	c, _ := w.add("c")
+
+	// a's poll times out and it polls again; it keeps its place
+	w.remove("a", a)
+	a, _ = w.add("a")
+	// b disconnects mid-poll
+	w.forget("b", b)
+	// c's poll times out and it never comes back
+	w.remove("c", c)
+
+	if !slices.Equal(w.order, []string{"a", "c"}) {
+		t.Fatalf("order = %v, want [a c]", w.order)
+	}
+	w.mu.Lock()
+	w.expire(time.Now().Add(watcherExpiry + time.Second))
+	w.mu.Unlock()
+	if !slices.Equal(w.order, []string{"a"}) {
+		t.Fatalf("order after expiry = %v, want [a]", w.order)
+	}
+	if got := w.successor(); got != "a" {
+		t.Fatalf("successor = %q, want a", got)
+	}
+	w.remove("a", a)
+}
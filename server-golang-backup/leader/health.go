@@ -0,0 +1,102 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/config"
+	"figma-mcp-bridge-v2/link"
+)
+
+const (
+	// How long the leader may go without a plugin before a leader stuck on a
+	// fallback port steps down to move back to the configured one
+	pluginGrace = 30 * time.Second
+	// Requests in a row the plugin may leave unanswered before the leader
+	// drops its connection so it reconnects
+	maxPluginTimeouts = 3
+)
+
+// SendWithParams forwards a request to the plugin, preferring one connected
+// directly over one behind a relay, see bridge.SetRelay. When no plugin is
+// connected the error says for how long and where the plugin should connect.
+func (l *Leader) SendWithParams(ctx context.Context, requestType string, nodeIDs []string, params map[string]interface{}) (bridge.Response, error) {
+	started := time.Now()
+	resp, err := l.sendToPlugin(ctx, requestType, nodeIDs, params)
+	observeRequest(requestType, resp, err, time.Since(started))
+	return resp, err
+}
+
+func (l *Leader) sendToPlugin(ctx context.Context, requestType string, nodeIDs []string, params map[string]interface{}) (bridge.Response, error) {
+	resp, err := l.bridge.SendWithParams(ctx, requestType, nodeIDs, params)
+	if errors.Is(err, bridge.ErrNotConnected) {
+		err = l.notConnectedError()
+	}
+	return resp, err
+}
+
+// pluginReachable reports whether a plugin is connected, directly or at the
+// relay
+func (l *Leader) pluginReachable() bool {
+	_, direct := l.bridge.ConnectedAt()
+	return direct || l.relay.PluginConnected()
+}
+
+// pluginChanged tells followers when a plugin becomes reachable or stops
+// being reachable. A direct plugin leaving while the relay still has one
+// changes nothing for them.
+func (l *Leader) pluginChanged() {
+	l.pluginMu.Lock()
+	defer l.pluginMu.Unlock()
+	connected := l.pluginReachable()
+	if connected == l.pluginUp {
+		return
+	}
+	l.pluginUp = connected
+	l.links.broadcast(link.EventPlugin, link.PluginEvent{Connected: connected})
+}
+
+func (l *Leader) notConnectedError() error {
+	since, ok := l.bridge.DisconnectedSince()
+	if !ok {
+		// Connected again in the meantime
+		return bridge.ErrNotConnected
+	}
+	wsURL := "ws" + strings.TrimPrefix(config.BaseURL(l.addr), "http") + "/ws"
+	return fmt.Errorf("%w for %s: open the Figma MCP Bridge plugin in Figma and check its Bridge URL is %s",
+		bridge.ErrNotConnected, l.now().Sub(since).Round(time.Second), wsURL)
+}
+
+// SelfCheck looks after the plugin connection and returns an error if this
+// leader should step down so another node can serve the plugin better
+func (l *Leader) SelfCheck() error {
+	if n := l.bridge.Timeouts(); n >= maxPluginTimeouts {
+		// The plugin is connected but stuck; a restart close frame makes
+		// it reconnect right away with fresh state
+		log.Printf("Plugin left %d requests in a row unanswered, asking it to reconnect", n)
+		l.bridge.CloseForRestart("unresponsive")
+	}
+
+	if l.addr == l.wantAddr {
+		return nil
+	}
+	since, ok := l.bridge.DisconnectedSince()
+	if !ok || l.now().Sub(since) < pluginGrace || l.relay.Active() {
+		// A relay dials the URL it was given, not the configured port
+		return nil
+	}
+	// The plugin only knows the configured port; once it is free again a
+	// fresh election puts the leader back on it
+	listener, err := l.netListen("tcp", l.wantAddr)
+	if err != nil {
+		return nil
+	}
+	listener.Close()
+	return fmt.Errorf("no plugin connected for %s on fallback %s and %s is free again",
+		l.now().Sub(since).Round(time.Second), l.addr, l.wantAddr)
+}
@@ -0,0 +1,165 @@
+package leader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"figma-mcp-bridge-v2/auth"
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/link"
+)
+
+// EpochHeader carries the epoch of the leader a follower believes it is
+// talking to. The leader rejects RPCs whose epoch is not its own.
+const EpochHeader = "X-Figma-Bridge-Epoch"
+
+// ErrNotLeader is returned by Probe when something answers on the leader
+// URL but cannot prove it is a bridge leader sharing our token
+var ErrNotLeader = errors.New("not a figma-bridge leader")
+
+// Identity identifies one leadership term. ID is random per leader process;
+// Epoch increases every time a node on this machine becomes leader.
+type Identity struct {
+	ID    string `json:"leaderId"`
+	Epoch uint64 `json:"epoch"`
+}
+
+// PingResponse is the body returned by /ping
+type PingResponse struct {
+	Status      string `json:"status"`
+	Version     string `json:"version"`
+	Protocol    int    `json:"protocol"`
+	MinProtocol int    `json:"minProtocol"`
+	Identity
+	// Proof is auth.Sign(token, nonce, ID, Epoch) for the nonce given in the
+	// request, present only when a nonce was sent
+	Proof string `json:"proof,omitempty"`
+}
+
+// Probe pings the leader at baseURL and verifies that it knows token. Any
+// HTTP server that merely answers 200 on /ping yields ErrNotLeader.
+func Probe(ctx context.Context, client *http.Client, baseURL, token string) (PingResponse, error) {
+	nonce, err := newID()
+	if err != nil {
+		return PingResponse{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/ping?nonce="+url.QueryEscape(nonce), nil)
+	if err != nil {
+		return PingResponse{}, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return PingResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return PingResponse{}, fmt.Errorf("%w: ping returned status %d", ErrNotLeader, resp.StatusCode)
+	}
+
+	var ping PingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ping); err != nil {
+		return PingResponse{}, fmt.Errorf("%w: %v", ErrNotLeader, err)
+	}
+	if ping.ID == "" || !auth.Verify(token, ping.Proof, nonce, ping.ID, formatEpoch(ping.Epoch)) {
+		return PingResponse{}, ErrNotLeader
+	}
+	return ping, nil
+}
+
+// EpochStore persists the highest leader epoch handed out on this machine,
+// so a new leader always gets a higher epoch than every previous one and a
+// former leader can tell that it has been superseded
+type EpochStore struct {
+	path string
+}
+
+// NewEpochStore creates an EpochStore backed by the file at path
+func NewEpochStore(path string) *EpochStore {
+	return &EpochStore{path: path}
+}
+
+// Current returns the highest epoch recorded so far, or 0 if none
+func (s *EpochStore) Current() uint64 {
+	if s == nil || s.path == "" {
+		return 0
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return 0
+	}
+	epoch, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return epoch
+}
+
+// Next records and returns an epoch higher than both the stored one and
+// seen, the highest epoch this node has observed from other leaders
+func (s *EpochStore) Next(seen uint64) (uint64, error) {
+	epoch := max(s.Current(), seen) + 1
+	if s == nil || s.path == "" {
+		return epoch, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return 0, err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(formatEpoch(epoch)+"\n"), 0o600); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return 0, err
+	}
+	return epoch, nil
+}
+
+// fence refuses requests meant for another leadership term. Bridge nodes,
+// which name themselves with NodeHeader, must send the epoch they verified.
+// Scripts calling /rpc or the REST API without either header are let
+// through, as they have no epoch to send, unless this leader knows it has
+// been superseded.
+func (l *Leader) fence(r *http.Request) error {
+	current := formatEpoch(l.identity.Epoch)
+	header := r.Header.Get(EpochHeader)
+	switch {
+	case l.Fenced():
+		return l.errSuperseded()
+	case header != "" && header != current:
+		return &bridge.Error{Code: bridge.CodeUnavailable, Message: "stale leader epoch " + header + ", current is " + current}
+	case header == "" && r.Header.Get(NodeHeader) != "":
+		return &bridge.Error{Code: bridge.CodeUnavailable, Message: "missing leader epoch, current is " + current}
+	}
+	return nil
+}
+
+// errSuperseded is the answer of a leader that has been fenced
+func (l *Leader) errSuperseded() *bridge.Error {
+	return &bridge.Error{Code: bridge.CodeUnavailable, Message: link.ErrSuperseded + ": epoch " + formatEpoch(l.identity.Epoch) + " is stale"}
+}
+
+func formatEpoch(epoch uint64) string {
+	return strconv.FormatUint(epoch, 10)
+}
+
+func newID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate id: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
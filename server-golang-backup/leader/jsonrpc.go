@@ -0,0 +1,314 @@
+package leader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/trace"
+)
+
+// /rpc also speaks JSON-RPC 2.0, so scripts and tools in any language can
+// call the leader directly:
+//
+//	curl -H "Authorization: Bearer $TOKEN" http://127.0.0.1:1994/rpc \
+//	  -d '{"jsonrpc":"2.0","id":1,"method":"get_node","params":{"nodeId":"1:2"}}'
+//
+// Methods are the plugin's request types and get_bridge_status. Params is an
+// object: nodeIds, or nodeId, selects nodes, timeout is in seconds, and any
+// other member such as depth, format or scale is passed to the plugin.
+// Batches of up to maxBatchCalls run batchWorkers at a time; notifications
+// run but get no response.
+
+// JSONRPCVersion is the only protocol version accepted
+const JSONRPCVersion = "2.0"
+
+// JSON-RPC error codes
+const (
+	JSONRPCParseError     = -32700
+	JSONRPCInvalidRequest = -32600
+	JSONRPCMethodNotFound = -32601
+	JSONRPCInvalidParams  = -32602
+	JSONRPCInternalError  = -32603
+	// JSONRPCServerError means the bridge or plugin failed the call; the
+	// error's data says how
+	JSONRPCServerError = -32000
+)
+
+// StatusMethod is the JSON-RPC method returning the ClusterStatus
+const StatusMethod = "get_bridge_status"
+
+const (
+	// maxRPCBody limits /rpc request bodies, batches included
+	maxRPCBody = 1 << 20
+	// maxBatchCalls limits the calls in one batch
+	maxBatchCalls = 50
+	// batchWorkers is how many calls of a batch run at once, so one batch
+	// cannot flood the plugin
+	batchWorkers = 4
+)
+
+// JSONRPCRequest is one call. A request without ID is a notification.
+type JSONRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// JSONRPCResponse answers the call with the same ID
+type JSONRPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *JSONRPCError   `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// JSONRPCError is a JSON-RPC error object
+type JSONRPCError struct {
+	Code    int               `json:"code"`
+	Message string            `json:"message"`
+	Data    *JSONRPCErrorData `json:"data,omitempty"`
+}
+
+// JSONRPCErrorData classifies a JSONRPCServerError like MCP tool errors
+type JSONRPCErrorData struct {
+	Code      bridge.Code `json:"code"`
+	Retryable bool        `json:"retryable"`
+	Hint      string      `json:"hint,omitempty"`
+}
+
+func (e *JSONRPCError) Error() string {
+	return e.Message
+}
+
+var nullID = json.RawMessage("null")
+
+// isJSONRPC tells a JSON-RPC body from the original /rpc envelope, which is
+// never an array and has no jsonrpc member
+func isJSONRPC(body []byte) bool {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		return true
+	}
+	var probe struct {
+		JSONRPC *string `json:"jsonrpc"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		// Malformed, but meant as JSON-RPC: answer with a parse error
+		return bytes.Contains(body, []byte(`"jsonrpc"`))
+	}
+	return probe.JSONRPC != nil
+}
+
+// serveJSONRPC answers a JSON-RPC request or batch
+func (l *Leader) serveJSONRPC(w http.ResponseWriter, r *http.Request, body []byte) {
+	if l.draining.Load() {
+		w.Header().Set("Retry-After", retryAfter)
+		writeJSONRPC(w, http.StatusServiceUnavailable, serverError(nullID, errDraining))
+		return
+	}
+	if err := l.fence(r); err != nil {
+		writeJSONRPC(w, http.StatusConflict, serverError(nullID, err))
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+	if body[0] != '[' {
+		if !json.Valid(body) {
+			writeJSONRPC(w, http.StatusOK, failure(nullID, JSONRPCParseError, "parse error"))
+			return
+		}
+		if reply := l.callJSONRPC(r, body); reply != nil {
+			writeJSONRPC(w, http.StatusOK, reply)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil {
+		writeJSONRPC(w, http.StatusOK, failure(nullID, JSONRPCParseError, "parse error"))
+		return
+	}
+	if len(batch) == 0 {
+		writeJSONRPC(w, http.StatusOK, failure(nullID, JSONRPCInvalidRequest, "empty batch"))
+		return
+	}
+	if len(batch) > maxBatchCalls {
+		writeJSONRPC(w, http.StatusOK, failure(nullID, JSONRPCInvalidRequest, fmt.Sprintf("batch has more than %d calls", maxBatchCalls)))
+		return
+	}
+
+	replies := make([]*JSONRPCResponse, len(batch))
+	workers := make(chan struct{}, batchWorkers)
+	var wg sync.WaitGroup
+	for i, call := range batch {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func() {
+			defer func() { <-workers }()
+			defer wg.Done()
+			replies[i] = l.callJSONRPC(r, call)
+		}()
+	}
+	wg.Wait()
+
+	answered := make([]*JSONRPCResponse, 0, len(replies))
+	for _, reply := range replies {
+		if reply != nil {
+			answered = append(answered, reply)
+		}
+	}
+	if len(answered) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSONRPC(w, http.StatusOK, answered)
+}
+
+// callJSONRPC runs one call and returns its response, or nil for a
+// notification
+func (l *Leader) callJSONRPC(r *http.Request, raw json.RawMessage) *JSONRPCResponse {
+	var req JSONRPCRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return failure(nullID, JSONRPCInvalidRequest, "invalid request")
+	}
+	if req.JSONRPC != JSONRPCVersion || req.Method == "" {
+		return failure(orNull(req.ID), JSONRPCInvalidRequest, `invalid request: want jsonrpc "2.0" and a method`)
+	}
+
+	result, err := l.invokeJSONRPC(r.Context(), r.Header.Get(NodeHeader), req.Method, req.Params)
+	if req.ID == nil {
+		return nil
+	}
+	var rpcErr *JSONRPCError
+	switch {
+	case errors.As(err, &rpcErr):
+		return &JSONRPCResponse{JSONRPC: JSONRPCVersion, Error: rpcErr, ID: req.ID}
+	case err != nil:
+		return serverError(req.ID, err)
+	}
+	return &JSONRPCResponse{JSONRPC: JSONRPCVersion, Result: result, ID: req.ID}
+}
+
+// invokeJSONRPC runs method and returns its encoded result. Errors about
+// the call itself are *JSONRPCError; the rest come from the bridge.
+func (l *Leader) invokeJSONRPC(ctx context.Context, nodeID, method string, raw json.RawMessage) (json.RawMessage, error) {
+	if method == StatusMethod {
+		return json.Marshal(l.ClusterStatus())
+	}
+	if !slices.Contains(bridge.RequestTypes, method) {
+		return nil, &JSONRPCError{Code: JSONRPCMethodNotFound, Message: "method not found: " + method}
+	}
+	call, err := parseJSONRPCParams(raw)
+	if err != nil {
+		return nil, &JSONRPCError{Code: JSONRPCInvalidParams, Message: err.Error()}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, l.requestTimeout(method, call.timeoutMs))
+	defer cancel()
+	resp, _, err := l.serveTraced(ctx, trace.SpanContext{}, bridge.Origin{Node: nodeID}, method, call.nodeIDs, call.params)
+	if nodeID != "" {
+		l.registry.recordRequest(nodeID, err != nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		return nil, &JSONRPCError{Code: JSONRPCInternalError, Message: err.Error()}
+	}
+	return data, nil
+}
+
+// jsonRPCCall is a call's params split the way the bridge takes them
+type jsonRPCCall struct {
+	nodeIDs   []string
+	params    map[string]interface{}
+	timeoutMs int64
+}
+
+func parseJSONRPCParams(raw json.RawMessage) (jsonRPCCall, error) {
+	var call jsonRPCCall
+	if len(raw) == 0 || string(raw) == "null" {
+		return call, nil
+	}
+	var params map[string]interface{}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return call, errors.New("params must be an object")
+	}
+
+	if v, ok := params["nodeIds"]; ok {
+		list, ok := v.([]interface{})
+		if !ok {
+			return call, errors.New("nodeIds must be an array of strings")
+		}
+		for _, item := range list {
+			id, ok := item.(string)
+			if !ok {
+				return call, errors.New("nodeIds must be an array of strings")
+			}
+			call.nodeIDs = append(call.nodeIDs, id)
+		}
+		delete(params, "nodeIds")
+	}
+	if v, ok := params["nodeId"]; ok {
+		id, ok := v.(string)
+		if !ok {
+			return call, errors.New("nodeId must be a string")
+		}
+		call.nodeIDs = append(call.nodeIDs, id)
+		delete(params, "nodeId")
+	}
+	if v, ok := params["timeout"]; ok {
+		seconds, ok := v.(float64)
+		if !ok || seconds <= 0 {
+			return call, fmt.Errorf("timeout must be a positive number of seconds")
+		}
+		call.timeoutMs = int64(seconds * 1000)
+		delete(params, "timeout")
+	}
+	if len(params) > 0 {
+		call.params = params
+	}
+	return call, nil
+}
+
+func failure(id json.RawMessage, code int, message string) *JSONRPCResponse {
+	return &JSONRPCResponse{JSONRPC: JSONRPCVersion, Error: &JSONRPCError{Code: code, Message: message}, ID: id}
+}
+
+// serverError reports a request the bridge failed, with its code
+func serverError(id json.RawMessage, err error) *JSONRPCResponse {
+	code := bridge.CodeOf(err)
+	return &JSONRPCResponse{
+		JSONRPC: JSONRPCVersion,
+		Error: &JSONRPCError{
+			Code:    JSONRPCServerError,
+			Message: err.Error(),
+			Data:    &JSONRPCErrorData{Code: code, Retryable: code.Retryable(), Hint: code.Hint()},
+		},
+		ID: id,
+	}
+}
+
+func orNull(id json.RawMessage) json.RawMessage {
+	if id == nil {
+		return nullID
+	}
+	return id
+}
+
+func writeJSONRPC(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -3,13 +3,24 @@ package leader
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"figma-mcp-bridge-v2/auth"
 	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/config"
+	"figma-mcp-bridge-v2/discovery"
+	"figma-mcp-bridge-v2/link"
+	"figma-mcp-bridge-v2/relay"
+	"figma-mcp-bridge-v2/trace"
 )
 
 // RPCRequest is the format for incoming RPC requests from followers
@@ -17,30 +28,119 @@ type RPCRequest struct {
 	Tool    string                 `json:"tool"`
 	NodeIDs []string               `json:"nodeIds,omitempty"`
 	Params  map[string]interface{} `json:"params,omitempty"`
+	// Session optionally names the caller's MCP client session
+	Session string `json:"session,omitempty"`
+	// TraceID and SpanID, if set, make the leader's span a child of the
+	// caller's
+	TraceID string `json:"traceId,omitempty"`
+	SpanID  string `json:"spanId,omitempty"`
+	// TimeoutMs, if set, is how long the caller waits for the answer
+	TimeoutMs int64 `json:"timeoutMs,omitempty"`
 }
 
 // RPCResponse is the format for RPC responses to followers
 type RPCResponse struct {
-	Data  interface{} `json:"data,omitempty"`
-	Error string      `json:"error,omitempty"`
+	Data   interface{}  `json:"data,omitempty"`
+	Error  string       `json:"error,omitempty"`
+	Code   bridge.Code  `json:"code,omitempty"`
+	Timing *link.Timing `json:"timing,omitempty"`
+}
+
+// Options configures access control for a Leader
+type Options struct {
+	// Token is required as a bearer token on /rpc and extra routes
+	Token string
+	// AllowedOrigins lists the Origin headers accepted on /ws
+	AllowedOrigins []string
+	// EpochFile persists leader epochs across processes
+	EpochFile string
+	// MinEpoch is the highest epoch the caller has seen from other
+	// leaders; the new epoch is always above it
+	MinEpoch uint64
+	// LockFile, if set, is held while leading and advertises the address,
+	// token and version to other processes. Holding it also lets the
+	// leader move to a free port when another program owns addr.
+	LockFile string
+	// StepDown, if set, is called when a node running a newer version asks
+	// to take over. It should stop the leader, e.g. by becoming follower.
+	StepDown func()
+	// Listen binds the leader's port; nil means net.Listen. Tests inject a
+	// fake network here.
+	Listen func(network, address string) (net.Listener, error)
+	// Now tells the time for the health checks; nil means time.Now. Tests
+	// inject a fake clock here.
+	Now func() time.Time
+	// RecordFile, if set, receives every plugin request and answer
+	RecordFile string
+	// ReplayFile, if set, is a session the bridge answers from instead of
+	// the plugin
+	ReplayFile string
+	// Clients optionally reports the MCP clients of the leader process
+	// for the cluster status
+	Clients func() []string
+	// Timeouts overrides how long requests from followers that do not say
+	// wait for the plugin
+	Timeouts bridge.Timeouts
 }
 
 // Leader owns the WebSocket bridge to Figma and exposes HTTP endpoints for followers
 type Leader struct {
-	addr     string
-	bridge   *bridge.Bridge
-	listener net.Listener
-	server   *http.Server
-	wg       sync.WaitGroup
+	addr       string
+	wantAddr   string // configured address; addr differs after a fallback
+	opts       Options
+	epochs     *EpochStore
+	identity   Identity
+	bridge     *bridge.Bridge
+	relay      *relay.Server // plugin reached through a relay process
+	listener   net.Listener
+	lock       *discovery.Lock
+	server     *http.Server
+	routes     map[string]http.Handler
+	watchers   *watchers
+	registry   *registry
+	links      *links
+	started    time.Time
+	draining   atomic.Bool
+	takeoverBy atomic.Pointer[string]
+	inflight   atomic.Int64
+	wg         sync.WaitGroup
+
+	pluginMu sync.Mutex
+	pluginUp bool // last plugin state broadcast to followers
 }
 
 // New creates a new Leader instance
-func New(addr string) *Leader {
+func New(addr string, opts Options) *Leader {
 	return &Leader{
-		addr: addr,
+		addr:     addr,
+		wantAddr: addr,
+		opts:     opts,
+		epochs:   NewEpochStore(opts.EpochFile),
+		routes:   make(map[string]http.Handler),
+		watchers: newWatchers(),
+		registry: newRegistry(),
+		links:    newLinks(),
 	}
 }
 
+// Handle registers an extra HTTP handler to be served alongside the bridge
+// endpoints. Like /rpc it requires the leader's token. It must be called
+// before Start.
+func (l *Leader) Handle(pattern string, handler http.Handler) {
+	l.routes[pattern] = handler
+}
+
+// Identity returns the leader's ID and epoch, valid once Start succeeded
+func (l *Leader) Identity() Identity {
+	return l.identity
+}
+
+// Fenced reports whether another node has since become leader with a higher
+// epoch, meaning this leader must stop serving
+func (l *Leader) Fenced() bool {
+	return l.epochs.Current() > l.identity.Epoch
+}
+
 // Bridge returns the underlying bridge for direct access
 func (l *Leader) Bridge() *bridge.Bridge {
 	return l.bridge
@@ -48,21 +148,86 @@ func (l *Leader) Bridge() *bridge.Bridge {
 
 // Start starts the leader with bridge and HTTP endpoints
 func (l *Leader) Start() error {
-	// Try to bind the port first to fail fast if already taken
-	listener, err := net.Listen("tcp", l.addr)
+	// The lockfile decides leadership when configured; otherwise holding
+	// the port does
+	if l.opts.LockFile != "" {
+		lock, err := discovery.Acquire(l.opts.LockFile)
+		if err != nil {
+			return err
+		}
+		l.lock = lock
+	}
+
+	listener, err := l.listen()
 	if err != nil {
-		return err // Port already in use
+		l.releaseLock()
+		return err
 	}
 	l.listener = listener
 
+	// Only the node holding the port gets to claim a new epoch
+	id, err := newID()
+	if err != nil {
+		listener.Close()
+		l.releaseLock()
+		return err
+	}
+	epoch, err := l.epochs.Next(l.opts.MinEpoch)
+	if err != nil {
+		listener.Close()
+		l.releaseLock()
+		return err
+	}
+	l.identity = Identity{ID: id, Epoch: epoch}
+	l.started = time.Now()
+
+	if l.lock != nil {
+		err := l.lock.Write(discovery.Record{
+			PID:       os.Getpid(),
+			Addr:      l.addr,
+			URL:       config.BaseURL(l.addr),
+			Version:   Version,
+			Epoch:     epoch,
+			StartedAt: l.started,
+		})
+		if err != nil {
+			listener.Close()
+			l.releaseLock()
+			return err
+		}
+	}
+
 	// Create the bridge with the same address
 	l.bridge = bridge.NewBridge(l.addr)
+	l.bridge.SetOriginCheck(auth.OriginChecker(l.opts.AllowedOrigins))
+	l.bridge.SetEpoch(epoch)
+	l.bridge.SetConnectionHook(func(bool) { l.pluginChanged() })
+	if err := l.startSession(); err != nil {
+		listener.Close()
+		l.releaseLock()
+		return err
+	}
+	l.relay = relay.NewServer()
+	l.relay.SetConnectionHook(func(bool) { l.pluginChanged() })
+	l.bridge.SetRelay(l.relay)
 
 	// Get the mux and add our HTTP endpoints
 	mux := l.bridge.Mux()
 	mux.HandleFunc("/ping", l.handlePing)
-	mux.HandleFunc("/rpc", l.handleRPC)
+	mux.Handle("/rpc", auth.Require(l.opts.Token, l.trackRPC(l.handleRPC)))
+	mux.Handle(link.Path, auth.Require(l.opts.Token, http.HandlerFunc(l.handleLink)))
+	mux.Handle("/watch", auth.Require(l.opts.Token, http.HandlerFunc(l.handleWatch)))
+	mux.Handle("/heartbeat", auth.Require(l.opts.Token, http.HandlerFunc(l.handleHeartbeat)))
+	mux.Handle("/cluster", auth.Require(l.opts.Token, http.HandlerFunc(l.handleCluster)))
+	mux.Handle("/takeover", auth.Require(l.opts.Token, http.HandlerFunc(l.handleTakeover)))
+	mux.Handle(relay.Path, auth.Require(l.opts.Token, l.relay))
+	mux.Handle("/metrics", auth.Require(l.opts.Token, http.HandlerFunc(l.handleMetrics)))
+	mux.HandleFunc(APIPrefix+"openapi.json", l.handleOpenAPI)
+	mux.Handle(APIPrefix, auth.Require(l.opts.Token, l.trackRPC(l.api().ServeHTTP)))
 	mux.HandleFunc("/ws", l.bridge.HandleWebSocket)
+	for pattern, handler := range l.routes {
+		mux.Handle(pattern, auth.Require(l.opts.Token, handler))
+	}
 
 	// Create server with the bridge's mux
 	l.server = &http.Server{
@@ -74,25 +239,102 @@ func (l *Leader) Start() error {
 	l.wg.Add(1)
 	go func() {
 		defer l.wg.Done()
-		log.Printf("Leader listening on %s", l.addr)
+		log.Printf("Leader listening on %s (epoch %d)", l.addr, l.identity.Epoch)
 		if err := l.server.Serve(l.listener); err != nil && err != http.ErrServerClosed {
 			log.Printf("Leader server error: %v", err)
 		}
 	}()
 
+	leaderTransitions.Inc()
 	return nil
 }
 
-// Stop gracefully stops the leader
+// Addr returns the address the leader listens on, which differs from the
+// configured one if it had to pick a free port
+func (l *Leader) Addr() string {
+	return l.addr
+}
+
+// Stop gracefully stops the leader, handing leadership to a follower
 func (l *Leader) Stop() {
 	if l.server != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := l.server.Shutdown(ctx); err != nil {
-			log.Printf("Leader shutdown error: %v", err)
-		}
+		l.handOff()
+		l.shutdownServer()
 	}
 	l.wg.Wait()
+	if l.bridge != nil {
+		l.bridge.StopRecording()
+	}
+	l.releaseLock()
+}
+
+// startSession sets up recording or replay of plugin traffic
+func (l *Leader) startSession() error {
+	if l.opts.ReplayFile != "" {
+		if err := l.bridge.Replay(l.opts.ReplayFile); err != nil {
+			return fmt.Errorf("cannot replay session: %w", err)
+		}
+		log.Printf("Answering from recorded session %s instead of the plugin", l.opts.ReplayFile)
+	}
+	if l.opts.RecordFile != "" {
+		if err := l.bridge.Record(l.opts.RecordFile); err != nil {
+			return fmt.Errorf("cannot record session: %w", err)
+		}
+		log.Printf("Recording plugin traffic to %s", l.opts.RecordFile)
+	}
+	return nil
+}
+
+// listen binds the configured address. A leader holding the lockfile knows
+// no other bridge owns the port, so if it is taken some unrelated program
+// has it and the leader falls back to a free port on the same host.
+func (l *Leader) listen() (net.Listener, error) {
+	listener, err := l.netListen("tcp", l.addr)
+	if err == nil {
+		if _, port, _ := net.SplitHostPort(l.addr); port == "0" {
+			// Asked for any free port, e.g. by tests
+			l.addr = listener.Addr().String()
+			l.wantAddr = l.addr
+		}
+		return listener, nil
+	}
+	if l.lock == nil {
+		return nil, err
+	}
+
+	host, _, splitErr := net.SplitHostPort(l.addr)
+	if splitErr != nil {
+		return nil, err
+	}
+	listener, fallbackErr := l.netListen("tcp", net.JoinHostPort(host, "0"))
+	if fallbackErr != nil {
+		return nil, err
+	}
+	log.Printf("%s is taken by another program (%v); listening on %s instead. Set the Bridge URL in the Figma plugin to ws://%s/ws.",
+		l.addr, err, listener.Addr(), listener.Addr())
+	l.addr = listener.Addr().String()
+	return listener, nil
+}
+
+func (l *Leader) now() time.Time {
+	if l.opts.Now != nil {
+		return l.opts.Now()
+	}
+	return time.Now()
+}
+
+func (l *Leader) netListen(network, address string) (net.Listener, error) {
+	if l.opts.Listen != nil {
+		return l.opts.Listen(network, address)
+	}
+	return net.Listen(network, address)
+}
+
+func (l *Leader) releaseLock() {
+	if l.lock != nil {
+		l.lock.Release()
+		l.lock = nil
+	}
 }
 
 // handlePing responds to health check requests
@@ -102,39 +344,92 @@ func (l *Leader) handlePing(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	resp := PingResponse{
+		Status:      "ok",
+		Version:     Version,
+		Protocol:    Protocol,
+		MinProtocol: MinProtocol,
+		Identity:    l.identity,
+	}
+	if nonce := r.URL.Query().Get("nonce"); nonce != "" {
+		resp.Proof = auth.Sign(l.opts.Token, nonce, l.identity.ID, formatEpoch(l.identity.Epoch))
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "ok",
-		"version": "0.1.0",
-	})
+	json.NewEncoder(w).Encode(resp)
 }
 
-// handleRPC handles RPC requests from followers
+// handleRPC handles RPC requests. JSON-RPC 2.0 requests and batches are
+// served by serveJSONRPC; anything else is the original follower envelope.
 func (l *Leader) handleRPC(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRPCBody))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		message := fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit)
+		if isJSONRPC(body) {
+			writeJSONRPC(w, http.StatusRequestEntityTooLarge, failure(nullID, JSONRPCInvalidRequest, message))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(RPCResponse{Error: message, Code: bridge.CodeTooLarge})
+		return
+	case err != nil:
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if isJSONRPC(body) {
+		l.serveJSONRPC(w, r, body)
+		return
+	}
+
+	if l.draining.Load() {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", retryAfter)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(RPCResponse{Error: errDraining.Message, Code: errDraining.Code})
+		return
+	}
+
+	// Fencing: a follower that still believes in an older (or newer) leader
+	// must re-probe before its request is accepted
+	if err := l.fence(r); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(RPCResponse{Error: err.Error(), Code: bridge.CodeUnavailable})
+		return
+	}
+
 	var req RPCRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.Unmarshal(body, &req); err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(RPCResponse{Error: "invalid request body"})
+		json.NewEncoder(w).Encode(RPCResponse{Error: "invalid request body", Code: bridge.CodeBadRequest})
 		return
 	}
 
-	// Forward to bridge with timeout
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), l.requestTimeout(req.Tool, req.TimeoutMs))
 	defer cancel()
 
-	resp, err := l.bridge.SendWithParams(ctx, req.Tool, req.NodeIDs, req.Params)
+	nodeID := r.Header.Get(NodeHeader)
+	parent := trace.SpanContext{TraceID: req.TraceID, SpanID: req.SpanID}
+	origin := bridge.Origin{Node: nodeID, Session: req.Session}
+	resp, timing, err := l.serveTraced(ctx, parent, origin, req.Tool, req.NodeIDs, req.Params)
+	if nodeID != "" {
+		l.registry.recordRequest(nodeID, err != nil)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err != nil {
-		json.NewEncoder(w).Encode(RPCResponse{Error: err.Error()})
+		json.NewEncoder(w).Encode(RPCResponse{Error: err.Error(), Code: bridge.CodeOf(err), Timing: timing})
 		return
 	}
 
-	json.NewEncoder(w).Encode(RPCResponse{Data: resp.Data})
+	json.NewEncoder(w).Encode(RPCResponse{Data: resp.Data, Timing: timing})
 }
@@ -0,0 +1,229 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/link"
+	"figma-mcp-bridge-v2/trace"
+)
+
+// linkUpgrader accepts follower links. Followers are not browsers and send no
+// Origin; the bearer token checked before upgrading is what authenticates them.
+var linkUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return r.Header.Get("Origin") == ""
+	},
+}
+
+// followerLink is the leader's end of one follower's persistent WebSocket
+type followerLink struct {
+	nodeID  string
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+func (fl *followerLink) send(msg link.Message) error {
+	fl.writeMu.Lock()
+	defer fl.writeMu.Unlock()
+	_ = fl.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return fl.conn.WriteJSON(msg)
+}
+
+// links tracks the open follower links so the leader can push events and
+// close them on handoff; hijacked connections are not closed by
+// http.Server.Shutdown
+type links struct {
+	mu  sync.Mutex
+	set map[*followerLink]struct{}
+}
+
+func newLinks() *links {
+	return &links{set: make(map[*followerLink]struct{})}
+}
+
+func (ls *links) add(fl *followerLink) {
+	ls.mu.Lock()
+	ls.set[fl] = struct{}{}
+	ls.mu.Unlock()
+}
+
+func (ls *links) remove(fl *followerLink) {
+	ls.mu.Lock()
+	delete(ls.set, fl)
+	ls.mu.Unlock()
+}
+
+func (ls *links) snapshot() []*followerLink {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	list := make([]*followerLink, 0, len(ls.set))
+	for fl := range ls.set {
+		list = append(list, fl)
+	}
+	return list
+}
+
+// broadcast pushes an event to every follower
+func (ls *links) broadcast(event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	for _, fl := range ls.snapshot() {
+		_ = fl.send(link.Message{Kind: link.KindEvent, Event: event, Data: payload})
+	}
+}
+
+// closeAll closes every follower link
+func (ls *links) closeAll() {
+	for _, fl := range ls.snapshot() {
+		_ = fl.conn.Close()
+	}
+}
+
+// handleLink upgrades a follower to a persistent link and serves requests on
+// it until the follower or the leader goes away
+func (l *Leader) handleLink(w http.ResponseWriter, r *http.Request) {
+	// Same fencing rule as /rpc, checked before upgrading
+	if err := l.fence(r); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if l.draining.Load() {
+		w.Header().Set("Retry-After", retryAfter)
+		http.Error(w, errDraining.Message, http.StatusServiceUnavailable)
+		return
+	}
+	if protocol, _ := strconv.Atoi(r.Header.Get(ProtocolHeader)); protocol < MinProtocol {
+		http.Error(w, fmt.Sprintf("protocol %d is no longer supported, need at least %d", protocol, MinProtocol), http.StatusUpgradeRequired)
+		return
+	}
+
+	conn, err := linkUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Link upgrade failed: %v", err)
+		return
+	}
+
+	fl := &followerLink{
+		nodeID:  r.Header.Get(NodeHeader),
+		conn:    conn,
+		cancels: make(map[string]context.CancelFunc),
+	}
+	l.links.add(fl)
+	if fl.nodeID != "" {
+		// An open link is a standing watch: its follower is in line to
+		// take over, and hears of the handoff on the link
+		if watch, _ := l.watchers.add(fl.nodeID); watch != nil {
+			defer l.watchers.forget(fl.nodeID, watch)
+		}
+	}
+	done := make(chan struct{})
+	link.KeepAlive(conn, done)
+	defer func() {
+		close(done)
+		l.links.remove(fl)
+		fl.mu.Lock()
+		for _, cancel := range fl.cancels {
+			cancel()
+		}
+		fl.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		var msg link.Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		switch msg.Kind {
+		case link.KindRequest:
+			l.serveLinkRequest(fl, msg)
+		case link.KindCancel:
+			fl.mu.Lock()
+			if cancel := fl.cancels[msg.ID]; cancel != nil {
+				cancel()
+			}
+			fl.mu.Unlock()
+		case link.KindHeartbeat:
+			var hb Heartbeat
+			if json.Unmarshal(msg.Data, &hb) != nil {
+				continue
+			}
+			if fl.nodeID != "" {
+				hb.ID = fl.nodeID
+			}
+			if hb.ID != "" {
+				l.registry.heartbeat(hb)
+			}
+		}
+	}
+}
+
+// serveLinkRequest runs one multiplexed request in the background and sends
+// its response on the link
+func (l *Leader) serveLinkRequest(fl *followerLink, msg link.Message) {
+	// The link was fenced when it opened, but a newer leader may have
+	// taken over since; refuse like /rpc and make the follower look again
+	if l.Fenced() {
+		err := l.errSuperseded()
+		_ = fl.send(link.Message{Kind: link.KindResponse, ID: msg.ID, Error: err.Message, Code: string(err.Code)})
+		_ = fl.conn.Close()
+		return
+	}
+	if l.draining.Load() {
+		_ = fl.send(link.Message{Kind: link.KindResponse, ID: msg.ID, Error: errDraining.Message, Code: string(errDraining.Code)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.requestTimeout(msg.Tool, msg.TimeoutMs))
+	ctx = bridge.WithProgress(ctx, func(p bridge.Progress) {
+		data, _ := json.Marshal(p)
+		_ = fl.send(link.Message{Kind: link.KindProgress, ID: msg.ID, Data: data})
+	})
+	fl.mu.Lock()
+	fl.cancels[msg.ID] = cancel
+	fl.mu.Unlock()
+
+	l.inflight.Add(1)
+	go func() {
+		defer l.inflight.Add(-1)
+		defer func() {
+			fl.mu.Lock()
+			delete(fl.cancels, msg.ID)
+			fl.mu.Unlock()
+			cancel()
+		}()
+
+		parent := trace.SpanContext{TraceID: msg.TraceID, SpanID: msg.SpanID}
+		origin := bridge.Origin{Node: fl.nodeID, Session: msg.Session}
+		resp, timing, err := l.serveTraced(ctx, parent, origin, msg.Tool, msg.NodeIDs, msg.Params)
+		if fl.nodeID != "" {
+			l.registry.recordRequest(fl.nodeID, err != nil)
+		}
+
+		reply := link.Message{Kind: link.KindResponse, ID: msg.ID, Timing: timing}
+		if err != nil {
+			reply.Error = err.Error()
+		} else if reply.Data, err = json.Marshal(resp.Data); err != nil {
+			reply.Error = err.Error()
+		}
+		reply.Code = string(bridge.CodeOf(err))
+		if err := fl.send(reply); err != nil {
+			log.Printf("Failed to answer follower %s: %v", fl.nodeID, err)
+		}
+	}()
+}
@@ -0,0 +1,89 @@
+package leader
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/metrics"
+)
+
+// Every plugin request goes through the leader, whether it came from its
+// own MCP clients, a follower's /link or /rpc, so these cover the cluster
+var (
+	requestsTotal = metrics.Default.Counter("figma_bridge_requests_total",
+		"Plugin requests handled by the leader, including those forwarded by followers.", "tool")
+	requestErrors = metrics.Default.Counter("figma_bridge_request_errors_total",
+		"Plugin requests that failed, by error code.", "tool", "code")
+	requestDuration = metrics.Default.Histogram("figma_bridge_request_duration_seconds",
+		"Time from sending a request to the plugin until its answer.", metrics.DefBuckets, "tool")
+	responseBytes = metrics.Default.Histogram("figma_bridge_response_bytes",
+		"Size of the plugin's answers.", metrics.SizeBuckets, "tool")
+	leaderTransitions = metrics.Default.Counter("figma_bridge_leader_transitions_total",
+		"Times this process became leader.")
+)
+
+func observeRequest(tool string, resp bridge.Response, err error, elapsed time.Duration) {
+	tool = toolLabel(tool)
+	requestsTotal.Inc(tool)
+	requestDuration.Observe(elapsed.Seconds(), tool)
+	if resp.Bytes > 0 {
+		responseBytes.Observe(float64(resp.Bytes), tool)
+	}
+	if err != nil {
+		requestErrors.Inc(tool, string(bridge.CodeOf(err)))
+	}
+}
+
+// toolLabel keeps the tool label to the known request types, so callers
+// of /rpc and /api/v1 cannot grow the metrics without bound by inventing
+// method names
+func toolLabel(tool string) string {
+	if slices.Contains(bridge.RequestTypes, tool) {
+		return tool
+	}
+	return "other"
+}
+
+// handleMetrics serves the process metrics plus the leader's current state
+// in the Prometheus text format
+func (l *Leader) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.Default.Write(w)
+
+	metrics.WriteGauge(w, "figma_bridge_leader_epoch", "Epoch of the current leader term.", float64(l.identity.Epoch))
+	metrics.WriteGauge(w, "figma_bridge_pending_requests", "Requests waiting for the plugin to answer.", float64(l.bridge.PendingCount()))
+	metrics.WriteGauge(w, "figma_bridge_inflight_rpcs", "Follower requests being served.", float64(l.inflight.Load()))
+
+	_, direct := l.bridge.ConnectedAt()
+	metrics.WriteHeader(w, "figma_bridge_plugin_connected", "Whether the plugin is connected, directly or through a relay.", "gauge")
+	metrics.WriteSample(w, "figma_bridge_plugin_connected", boolValue(direct), "via", "direct")
+	metrics.WriteSample(w, "figma_bridge_plugin_connected", boolValue(l.relay.PluginConnected()), "via", "relay")
+
+	followers := l.registry.list()
+	metrics.WriteGauge(w, "figma_bridge_followers", "Followers that sent a heartbeat recently.", float64(len(followers)))
+	metrics.WriteGauge(w, "figma_bridge_follower_links", "Open follower /link connections.", float64(len(l.links.snapshot())))
+
+	// Per-follower counts start over with every leader term
+	metrics.WriteHeader(w, "figma_bridge_follower_requests_total", "Requests forwarded by each follower during this leader term.", "counter")
+	for _, f := range followers {
+		metrics.WriteSample(w, "figma_bridge_follower_requests_total", float64(f.Requests), "node", f.ID, "client", f.Client)
+	}
+	metrics.WriteHeader(w, "figma_bridge_follower_errors_total", "Failed requests forwarded by each follower during this leader term.", "counter")
+	for _, f := range followers {
+		metrics.WriteSample(w, "figma_bridge_follower_errors_total", float64(f.Errors), "node", f.ID, "client", f.Client)
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
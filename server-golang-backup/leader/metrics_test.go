@@ -0,0 +1,33 @@
+package leader
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/metrics"
+)
+
+func TestUnknownToolsShareALabel(t *testing.T) {
+	observeRequest("get_selection", bridge.Response{}, nil, time.Millisecond)
+	observeRequest("made_up_1", bridge.Response{}, errors.New("boom"), time.Millisecond)
+	observeRequest("made_up_2", bridge.Response{}, nil, time.Millisecond)
+
+	var out strings.Builder
+	metrics.Default.Write(&out)
+	text := out.String()
+	if strings.Contains(text, "made_up") {
+		t.Fatalf("unknown tool names reached the metrics:\n%s", text)
+	}
+	for _, want := range []string{
+		`figma_bridge_requests_total{tool="get_selection"} `,
+		`figma_bridge_requests_total{tool="other"} 2`,
+		`figma_bridge_request_errors_total{tool="other",code="internal"} 1`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("metrics lack %s:\n%s", want, text)
+		}
+	}
+}
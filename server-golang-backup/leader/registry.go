@@ -0,0 +1,214 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"figma-mcp-bridge-v2/auth"
+)
+
+const (
+	// HeartbeatInterval is how often followers report to the leader
+	HeartbeatInterval = 5 * time.Second
+	// Followers silent for longer than this are dropped from the registry
+	followerTTL = 3 * HeartbeatInterval
+)
+
+// NodeHeader carries the node ID of the follower making an RPC so the leader
+// can attribute request counts
+const NodeHeader = "X-Figma-Bridge-Node"
+
+// Heartbeat is what a follower sends on the link, or to /heartbeat from
+// before the link carried it
+type Heartbeat struct {
+	ID      string `json:"id"`
+	PID     int    `json:"pid"`
+	Client  string `json:"client,omitempty"`
+	Version string `json:"version"`
+}
+
+// FollowerInfo is the leader's view of one registered follower
+type FollowerInfo struct {
+	Heartbeat
+	RegisteredAt time.Time `json:"registeredAt"`
+	LastSeen     time.Time `json:"lastSeen"`
+	Requests     uint64    `json:"requests"`
+	Errors       uint64    `json:"errors"`
+}
+
+// LeaderInfo describes the leader itself in a ClusterStatus
+type LeaderInfo struct {
+	Identity
+	PID       int       `json:"pid"`
+	Version   string    `json:"version"`
+	Addr      string    `json:"addr"`
+	StartedAt time.Time `json:"startedAt"`
+	Clients   []string  `json:"clients,omitempty"`
+}
+
+// PluginStatus describes the Figma plugin connection
+type PluginStatus struct {
+	Connected         bool       `json:"connected"`
+	ConnectedAt       *time.Time `json:"connectedAt,omitempty"`
+	DisconnectedSince *time.Time `json:"disconnectedSince,omitempty"`
+	// Timeouts counts requests in a row the plugin did not answer in time
+	Timeouts int `json:"timeouts,omitempty"`
+	// Relay is set when the plugin reaches this leader through a relay
+	Relay bool `json:"relay,omitempty"`
+	// Replay is set when answers come from a recorded session
+	Replay bool `json:"replay,omitempty"`
+}
+
+// ClusterStatus is served by /cluster and the get_bridge_status tool
+type ClusterStatus struct {
+	Leader          LeaderInfo     `json:"leader"`
+	Plugin          PluginStatus   `json:"plugin"`
+	PendingRequests int            `json:"pendingRequests"`
+	Followers       []FollowerInfo `json:"followers"`
+}
+
+// registry tracks the followers that have sent heartbeats
+type registry struct {
+	mu        sync.Mutex
+	followers map[string]*FollowerInfo
+}
+
+func newRegistry() *registry {
+	return &registry{followers: make(map[string]*FollowerInfo)}
+}
+
+func (r *registry) heartbeat(hb Heartbeat) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, ok := r.followers[hb.ID]
+	if !ok {
+		info = &FollowerInfo{RegisteredAt: now}
+		r.followers[hb.ID] = info
+	}
+	info.Heartbeat = hb
+	info.LastSeen = now
+}
+
+func (r *registry) recordRequest(id string, failed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, ok := r.followers[id]
+	if !ok {
+		// An RPC can arrive before the first heartbeat
+		info = &FollowerInfo{Heartbeat: Heartbeat{ID: id}, RegisteredAt: time.Now()}
+		r.followers[id] = info
+	}
+	info.LastSeen = time.Now()
+	info.Requests++
+	if failed {
+		info.Errors++
+	}
+}
+
+// list returns live followers, oldest first, dropping silent ones
+func (r *registry) list() []FollowerInfo {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]FollowerInfo, 0, len(r.followers))
+	for id, info := range r.followers {
+		if now.Sub(info.LastSeen) > followerTTL {
+			delete(r.followers, id)
+			continue
+		}
+		list = append(list, *info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].RegisteredAt.Before(list[j].RegisteredAt)
+	})
+	return list
+}
+
+// ClusterStatus returns the leader's view of the cluster
+func (l *Leader) ClusterStatus() ClusterStatus {
+	status := ClusterStatus{
+		Leader: LeaderInfo{
+			Identity:  l.identity,
+			PID:       os.Getpid(),
+			Version:   Version,
+			Addr:      l.addr,
+			StartedAt: l.started,
+		},
+		PendingRequests: l.bridge.PendingCount(),
+		Followers:       l.registry.list(),
+	}
+	if l.opts.Clients != nil {
+		status.Leader.Clients = l.opts.Clients()
+	}
+	if connectedAt, ok := l.bridge.ConnectedAt(); ok {
+		status.Plugin = PluginStatus{Connected: true, ConnectedAt: &connectedAt, Timeouts: l.bridge.Timeouts()}
+	} else if l.relay.PluginConnected() {
+		status.Plugin = PluginStatus{Connected: true, Relay: true}
+	} else if since, ok := l.bridge.DisconnectedSince(); ok {
+		status.Plugin = PluginStatus{DisconnectedSince: &since, Relay: l.relay.Active()}
+	}
+	status.Plugin.Replay = l.bridge.Replaying()
+	return status
+}
+
+// handleHeartbeat registers or refreshes a follower that predates
+// heartbeats on the link
+func (l *Leader) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var hb Heartbeat
+	if err := json.NewDecoder(r.Body).Decode(&hb); err != nil || hb.ID == "" {
+		http.Error(w, "invalid heartbeat", http.StatusBadRequest)
+		return
+	}
+	l.registry.heartbeat(hb)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCluster serves the cluster status
+func (l *Leader) handleCluster(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l.ClusterStatus())
+}
+
+// FetchClusterStatus asks the leader at baseURL for its cluster status
+func FetchClusterStatus(ctx context.Context, client *http.Client, baseURL, token string) (ClusterStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/cluster", nil)
+	if err != nil {
+		return ClusterStatus{}, err
+	}
+	auth.SetHeader(req, token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return ClusterStatus{}, fmt.Errorf("failed to call leader: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ClusterStatus{}, fmt.Errorf("leader returned status %d", resp.StatusCode)
+	}
+
+	var status ClusterStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return ClusterStatus{}, fmt.Errorf("failed to decode cluster status: %w", err)
+	}
+	return status, nil
+}
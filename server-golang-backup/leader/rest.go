@@ -0,0 +1,220 @@
+package leader
+
+import (
+	"context"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/trace"
+)
+
+// APIPrefix is where the REST API for scripts and CI lives. It serves the
+// same requests as the MCP tools, e.g.
+//
+//	curl -H "Authorization: Bearer $TOKEN" -o logo.png \
+//	  "http://127.0.0.1:1994/api/v1/nodes/1:6/export?format=png&scale=2"
+const APIPrefix = "/api/v1/"
+
+// openAPI describes the REST API; it is served without a token
+//
+//go:embed openapi.json
+var openAPI []byte
+
+// APIError is the body of every failed REST request
+type APIError struct {
+	Error APIErrorDetail `json:"error"`
+}
+
+// APIErrorDetail classifies a failure like MCP tool errors
+type APIErrorDetail struct {
+	Code      bridge.Code `json:"code"`
+	Message   string      `json:"message"`
+	Retryable bool        `json:"retryable"`
+	Hint      string      `json:"hint,omitempty"`
+}
+
+// exportTypes maps export formats to the Content-Type they are served as
+var exportTypes = map[string]string{
+	"PNG": "image/png",
+	"JPG": "image/jpeg",
+	"SVG": "image/svg+xml",
+	"PDF": "application/pdf",
+}
+
+// api returns the handler for everything below APIPrefix
+func (l *Leader) api() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+APIPrefix+"selection", l.handleAPISelection)
+	mux.HandleFunc("GET "+APIPrefix+"nodes/{id}", l.handleAPINode)
+	mux.HandleFunc("GET "+APIPrefix+"nodes/{id}/export", l.handleAPIExport)
+	mux.HandleFunc("GET "+APIPrefix+"variables", l.handleAPIVariables)
+	mux.HandleFunc(APIPrefix, handleAPINotFound)
+	return mux
+}
+
+func (l *Leader) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPI)
+}
+
+// handleAPINotFound answers requests no route matches, keeping the JSON
+// error body scripts expect
+func handleAPINotFound(w http.ResponseWriter, r *http.Request) {
+	err := &bridge.Error{
+		Code:    bridge.CodeNotFound,
+		Message: fmt.Sprintf("no endpoint %s %s; see %sopenapi.json", r.Method, r.URL.Path, APIPrefix),
+	}
+	writeAPIError(w, err)
+}
+
+func (l *Leader) handleAPISelection(w http.ResponseWriter, r *http.Request) {
+	l.serveAPI(w, r, "get_selection", nil, nil)
+}
+
+func (l *Leader) handleAPINode(w http.ResponseWriter, r *http.Request) {
+	l.serveAPI(w, r, "get_node", []string{r.PathValue("id")}, nil)
+}
+
+func (l *Leader) handleAPIVariables(w http.ResponseWriter, r *http.Request) {
+	l.serveAPI(w, r, "get_variable_defs", nil, nil)
+}
+
+// handleAPIExport serves a node's export as the image or PDF itself
+func (l *Leader) handleAPIExport(w http.ResponseWriter, r *http.Request) {
+	format := strings.ToUpper(r.URL.Query().Get("format"))
+	switch format {
+	case "":
+		format = "PNG"
+	case "JPEG":
+		format = "JPG"
+	}
+	contentType, ok := exportTypes[format]
+	if !ok {
+		writeAPIError(w, &bridge.Error{Code: bridge.CodeBadRequest, Message: "format must be png, jpg, svg or pdf"})
+		return
+	}
+	params := map[string]interface{}{"format": format}
+	if value := r.URL.Query().Get("scale"); value != "" {
+		scale, err := strconv.ParseFloat(value, 64)
+		if err != nil || scale <= 0 || scale > 4 {
+			writeAPIError(w, &bridge.Error{Code: bridge.CodeBadRequest, Message: "scale must be a number above 0 and up to 4"})
+			return
+		}
+		params["scale"] = scale
+	}
+
+	resp, err := l.callAPI(r, "get_screenshot", []string{r.PathValue("id")}, params)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	data, err := decodeExport(resp.Data)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// serveAPI answers with the plugin's data as JSON
+func (l *Leader) serveAPI(w http.ResponseWriter, r *http.Request, tool string, nodeIDs []string, params map[string]interface{}) {
+	resp, err := l.callAPI(r, tool, nodeIDs, params)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp.Data)
+}
+
+// callAPI sends a REST request to the plugin, waiting as long as the
+// timeout query parameter, in seconds, or the tool's timeout says
+func (l *Leader) callAPI(r *http.Request, tool string, nodeIDs []string, params map[string]interface{}) (bridge.Response, error) {
+	if l.draining.Load() {
+		return bridge.Response{}, errDraining
+	}
+	if err := l.fence(r); err != nil {
+		return bridge.Response{}, err
+	}
+	var timeoutMs int64
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || seconds <= 0 {
+			return bridge.Response{}, &bridge.Error{Code: bridge.CodeBadRequest, Message: "timeout must be a positive number of seconds"}
+		}
+		timeoutMs = int64(seconds * float64(time.Second/time.Millisecond))
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), l.requestTimeout(tool, timeoutMs))
+	defer cancel()
+	resp, _, err := l.serveTraced(ctx, trace.SpanContext{}, bridge.Origin{}, tool, nodeIDs, params)
+	return resp, err
+}
+
+// decodeExport extracts the first export's bytes from a get_screenshot
+// answer
+func decodeExport(data interface{}) ([]byte, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var answer struct {
+		Exports []struct {
+			Base64 string `json:"base64"`
+		} `json:"exports"`
+	}
+	if err := json.Unmarshal(raw, &answer); err != nil || len(answer.Exports) == 0 {
+		return nil, errors.New("plugin returned no export")
+	}
+	image, err := base64.StdEncoding.DecodeString(answer.Exports[0].Base64)
+	if err != nil {
+		return nil, fmt.Errorf("plugin returned an invalid export: %w", err)
+	}
+	return image, nil
+}
+
+// writeAPIError answers with err's code and the matching HTTP status
+func writeAPIError(w http.ResponseWriter, err error) {
+	code := bridge.CodeOf(err)
+	if code.Retryable() {
+		w.Header().Set("Retry-After", "1")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiStatus(code))
+	json.NewEncoder(w).Encode(APIError{Error: APIErrorDetail{
+		Code:      code,
+		Message:   err.Error(),
+		Retryable: code.Retryable(),
+		Hint:      code.Hint(),
+	}})
+}
+
+func apiStatus(code bridge.Code) int {
+	switch code {
+	case bridge.CodeBadRequest:
+		return http.StatusBadRequest
+	case bridge.CodeNodeNotFound, bridge.CodeNotFound:
+		return http.StatusNotFound
+	case bridge.CodePermissionDenied:
+		return http.StatusForbidden
+	case bridge.CodeTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case bridge.CodeUnsupported:
+		return http.StatusNotImplemented
+	case bridge.CodeTimeout:
+		return http.StatusGatewayTimeout
+	case bridge.CodeNotConnected, bridge.CodeUnavailable, bridge.CodeCancelled:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
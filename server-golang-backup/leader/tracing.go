@@ -0,0 +1,39 @@
+package leader
+
+import (
+	"context"
+	"time"
+
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/link"
+	"figma-mcp-bridge-v2/trace"
+)
+
+// serveTraced runs a request from another process in a server span that
+// continues the caller's trace, and returns the timing to send back so the
+// caller can tell the leader's share from the plugin's
+func (l *Leader) serveTraced(ctx context.Context, parent trace.SpanContext, origin bridge.Origin, tool string, nodeIDs []string, params map[string]interface{}) (bridge.Response, *link.Timing, error) {
+	ctx = bridge.WithOrigin(ctx, origin)
+	ctx, span := trace.Start(trace.WithRemoteParent(ctx, parent), "serve "+tool, trace.KindServer)
+	if origin.Node != "" {
+		span.SetAttr("figma_bridge.follower", origin.Node)
+	}
+	span.SetAttr("figma_bridge.epoch", l.identity.Epoch)
+
+	resp, err := l.SendWithParams(ctx, tool, nodeIDs, params)
+	elapsed := span.End(err)
+	return resp, &link.Timing{LeaderMs: millis(elapsed), PluginMs: millis(resp.Duration)}, err
+}
+
+// requestTimeout is how long a request from another process may wait for
+// the plugin: what the caller asked for, else the configured timeout
+func (l *Leader) requestTimeout(tool string, timeoutMs int64) time.Duration {
+	if timeoutMs > 0 {
+		return bridge.ClampTimeout(time.Duration(timeoutMs) * time.Millisecond)
+	}
+	return l.opts.Timeouts.For(tool)
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,149 @@
+package leader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"figma-mcp-bridge-v2/auth"
+)
+
+// Version is the bridge version reported by /ping
+const Version = "0.1.0"
+
+// Protocol is the version of the leader/follower wire protocol: /link
+// messages and /cluster, plus /watch and /heartbeat for followers from
+// before the link carried them. Bump it on incompatible changes and raise
+// MinProtocol once the old one is no longer served.
+const (
+	Protocol    = 1
+	MinProtocol = 1
+)
+
+// ProtocolHeader carries the protocol a follower speaks when it opens a link
+const ProtocolHeader = "X-Figma-Bridge-Protocol"
+
+// ErrIncompatible is returned when a leader and a follower cannot talk
+// because neither supports the other's protocol
+var ErrIncompatible = errors.New("incompatible figma-bridge protocol")
+
+// Compatible reports whether a peer speaking protocol and accepting down to
+// minProtocol can talk with this binary
+func Compatible(protocol, minProtocol int) bool {
+	return minProtocol <= Protocol && MinProtocol <= protocol
+}
+
+// Compatible reports whether the leader that sent p can serve this binary
+func (p PingResponse) Compatible() bool {
+	// Leaders from before protocol negotiation report 0
+	return Compatible(p.Protocol, p.MinProtocol)
+}
+
+// NewerVersion reports whether version a is strictly newer than b. Versions
+// are dot-separated numbers; anything after a '-' or '+' is ignored.
+func NewerVersion(a, b string) bool {
+	pa, pb := parseVersion(a), parseVersion(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return false
+}
+
+func parseVersion(v string) []int {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	var parts []int
+	for _, s := range strings.Split(v, ".") {
+		n, _ := strconv.Atoi(s)
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// TakeoverRequest is sent to /takeover by a follower running a newer
+// version that wants to lead
+type TakeoverRequest struct {
+	ID          string `json:"id"`
+	Version     string `json:"version"`
+	Protocol    int    `json:"protocol"`
+	MinProtocol int    `json:"minProtocol,omitempty"`
+}
+
+// handleTakeover hands leadership to a follower running a newer version, so
+// a rolling upgrade converges on the newest binary
+func (l *Leader) handleTakeover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TakeoverRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+		http.Error(w, "invalid takeover request", http.StatusBadRequest)
+		return
+	}
+	if !NewerVersion(req.Version, Version) {
+		http.Error(w, fmt.Sprintf("version %s is not newer than %s", req.Version, Version), http.StatusConflict)
+		return
+	}
+	if !Compatible(req.Protocol, req.MinProtocol) {
+		// Followers running this binary could not follow it
+		http.Error(w, fmt.Sprintf("protocol %d-%d is incompatible with our %d-%d", req.MinProtocol, req.Protocol, MinProtocol, Protocol), http.StatusConflict)
+		return
+	}
+	if l.opts.StepDown == nil {
+		http.Error(w, "this leader cannot step down", http.StatusConflict)
+		return
+	}
+	if !l.takeoverBy.CompareAndSwap(nil, &req.ID) {
+		// Already handing off to someone
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	log.Printf("Node %s runs version %s, newer than our %s; stepping down", req.ID, req.Version, Version)
+	w.WriteHeader(http.StatusAccepted)
+	go l.opts.StepDown()
+}
+
+// RequestTakeover asks the leader at baseURL to hand leadership to the node
+// described by req
+func RequestTakeover(ctx context.Context, client *http.Client, baseURL, token string, req TakeoverRequest) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/takeover", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	auth.SetHeader(httpReq, token)
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("takeover returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package leader
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []int
+	}{
+		{"1.2.3", []int{1, 2, 3}},
+		{"v1.2.3", []int{1, 2, 3}},
+		{"1.2", []int{1, 2}},
+		{"1.2.3-rc.1", []int{1, 2, 3}},
+		{"1.2.3+build.7", []int{1, 2, 3}},
+		// Garbage parts count as 0 rather than failing
+		{"1.x.3", []int{1, 0, 3}},
+		{"dev", []int{0}},
+		{"", []int{0}},
+	}
+	for _, tt := range tests {
+		if got := parseVersion(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("parseVersion(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNewerVersion(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"0.2.0", "0.1.0", true},
+		{"0.1.0", "0.2.0", false},
+		{"0.1.0", "0.1.0", false},
+		{"0.10.0", "0.9.0", true},
+		{"1.0.0", "0.99.99", true},
+		// Missing parts are 0
+		{"0.1.1", "0.1", true},
+		{"0.1", "0.1.0", false},
+		{"0.1.0", "0.1", false},
+		// Pre-release and build suffixes are ignored, so a release does
+		// not take over from its own release candidate or vice versa
+		{"0.2.0", "0.2.0-rc.1", false},
+		{"0.2.0-rc.1", "0.2.0", false},
+		{"0.2.0-rc.1", "0.1.9", true},
+		{"v0.2.0", "0.1.0", true},
+		// Unparseable versions never look newer than a real one
+		{"dev", "0.1.0", false},
+		{"0.1.0", "dev", true},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got := NewerVersion(tt.a, tt.b); got != tt.want {
+			t.Errorf("NewerVersion(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	tests := []struct {
+		name                  string
+		protocol, minProtocol int
+		want                  bool
+	}{
+		{"same", Protocol, MinProtocol, true},
+		{"newer but still accepts ours", Protocol + 1, Protocol, true},
+		{"dropped ours", Protocol + 2, Protocol + 1, false},
+		{"older than we accept", MinProtocol - 1, 0, false},
+		// Peers from before negotiation report 0
+		{"unknown", 0, 0, false},
+	}
+	for _, tt := range tests {
+		if got := Compatible(tt.protocol, tt.minProtocol); got != tt.want {
+			t.Errorf("%s: Compatible(%d, %d) = %v, want %v", tt.name, tt.protocol, tt.minProtocol, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package link
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Path is where the leader accepts follower links
+const Path = "/link"
+
+const (
+	// PingInterval is how often each end of a link pings the other
+	PingInterval = 15 * time.Second
+	// PongWait is how long an end waits for a pong before it gives up on
+	// a peer that vanished without closing the connection
+	PongWait = 2 * PingInterval
+)
+
+// Message kinds carried over a link
+const (
+	// KindRequest is a tool call from follower to leader
+	KindRequest = "request"
+	// KindResponse answers the request with the same ID
+	KindResponse = "response"
+	// KindCancel tells the leader the caller gave up on a request
+	KindCancel = "cancel"
+	// KindProgress reports how far the request with the same ID got; Data
+	// is the plugin's bridge.Progress
+	KindProgress = "progress"
+	// KindEvent is pushed by the leader without a request
+	KindEvent = "event"
+	// KindHeartbeat registers the follower with the leader or refreshes
+	// its entry; Data is the leader's Heartbeat
+	KindHeartbeat = "heartbeat"
+)
+
+// Events pushed by the leader
+const (
+	// EventPlugin reports a plugin connect or disconnect; Data is PluginEvent
+	EventPlugin = "plugin"
+	// EventShutdown announces a handoff; Data is the leader's WatchEvent
+	EventShutdown = "shutdown"
+)
+
+// ErrDraining is the error a leader answers with when it refused a request
+// because it is handing off; the request did not run
+const ErrDraining = "leader is shutting down"
+
+// ErrSuperseded starts the error a leader answers with once a leader with a
+// higher epoch took over; the request did not run
+const ErrSuperseded = "leader was superseded"
+
+// Message is a single frame on the persistent follower-to-leader WebSocket.
+// Requests, responses, cancellations and events are multiplexed by ID.
+type Message struct {
+	Kind    string                 `json:"kind"`
+	ID      string                 `json:"id,omitempty"`
+	Tool    string                 `json:"tool,omitempty"`
+	NodeIDs []string               `json:"nodeIds,omitempty"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+	Event   string                 `json:"event,omitempty"`
+	Data    json.RawMessage        `json:"data,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+	// Code classifies Error, see bridge.Code
+	Code string `json:"code,omitempty"`
+	// Origin and Session name the node and MCP client session a request
+	// started from, when that is not the sender itself
+	Origin  string `json:"origin,omitempty"`
+	Session string `json:"session,omitempty"`
+	// TraceID and SpanID identify the sender's span on requests, so the
+	// receiver continues the same trace
+	TraceID string `json:"traceId,omitempty"`
+	SpanID  string `json:"spanId,omitempty"`
+	// TimeoutMs on requests is how long the caller still waits, so the
+	// receiver gives up when it does
+	TimeoutMs int64 `json:"timeoutMs,omitempty"`
+	// Timing on responses says where the time went on the far side
+	Timing *Timing `json:"timing,omitempty"`
+}
+
+// Timing breaks down a response's latency by hop, in milliseconds
+type Timing struct {
+	// LeaderMs is the time from the leader receiving the request to
+	// answering it, including the plugin
+	LeaderMs float64 `json:"leaderMs,omitempty"`
+	// PluginMs is the time the plugin took to answer
+	PluginMs float64 `json:"pluginMs,omitempty"`
+}
+
+// PluginEvent is the payload of EventPlugin
+type PluginEvent struct {
+	Connected bool `json:"connected"`
+}
+
+// KeepAlive pings the peer on conn every PingInterval until done is closed,
+// and makes reads on conn fail once no pong arrived for PongWait
+func KeepAlive(conn *websocket.Conn, done <-chan struct{}) {
+	_ = conn.SetReadDeadline(time.Now().Add(PongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(PongWait))
+	})
+	go func() {
+		ticker := time.NewTicker(PingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+}
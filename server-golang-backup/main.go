@@ -2,50 +2,240 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
-	"figma-mcp-bridge-v2/election"
-	mcpbridge "figma-mcp-bridge-v2/mcp"
-	"figma-mcp-bridge-v2/node"
+	"figma-mcp-bridge-v2/auth"
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/config"
+	"figma-mcp-bridge-v2/daemon"
+	"figma-mcp-bridge-v2/relay"
+	"figma-mcp-bridge-v2/server"
+	"figma-mcp-bridge-v2/trace"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
+// Idle time after which `serve` exits when no client is connected
+const defaultIdleTimeout = 10 * time.Minute
+
+// Usage:
+//
+//	figma-bridge [-transport stdio|http|both]  every process takes part in the election
+//	figma-bridge -role leader|follower         fixed role, no election
+//	figma-bridge serve [-idle-timeout 10m]     long-lived daemon owning the WebSocket
+//	figma-bridge stdio                         thin proxy to the daemon, starting it if needed
+//	figma-bridge relay -remote URL             serve the plugin locally for a leader elsewhere
+//
+// All modes accept -config, -profile, -addr, -port, -leader-url and -token,
+// which can also be set through FIGMA_BRIDGE_* environment variables or the
+// config file. A follower given -leader-url talks to that leader directly,
+// wherever it runs, instead of looking for a local one.
+//
+// A relay runs next to Figma when the leader does not, e.g. in a
+// devcontainer or on an SSH host. It owns the plugin WebSocket on -addr and
+// dials the leader at -remote, authenticating with the leader's -token. The
+// leader binds 127.0.0.1 by default, so its port must be made reachable from
+// the Figma machine: forward it with ssh -L, or start the leader with a
+// non-loopback -addr.
+//
+// -timeouts tool=duration,... overrides how long tools wait for Figma.
+//
+// -trace-file and -trace-endpoint export a span per hop of every tool call
+// (MCP tool, follower, leader, relay, plugin) as OTLP/JSON.
 func main() {
-	addr := ":1994"
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "stdio":
+			runStdio(os.Args[2:])
+			return
+		case "relay":
+			if err := runRelay(os.Args[2:]); err != nil {
+				log.Fatalf("Relay stopped: %v", err)
+			}
+			return
+		}
+	}
+	runElection(os.Args[1:])
+}
+
+// loadConfig registers the shared config flags on fs, parses args and
+// resolves the configuration, exiting on error
+func loadConfig(fs *flag.FlagSet, args []string) config.Config {
+	flags := config.RegisterFlags(fs)
+	fs.Parse(args)
+
+	cfg, err := flags.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if cfg.Profile != "" {
+		log.Printf("Using profile %q (%s)", cfg.Profile, cfg.Addr)
+	}
+	return cfg
+}
+
+// startTracing exports spans as configured and returns a function flushing
+// them on exit
+func startTracing(cfg config.Config) func() {
+	switch {
+	case cfg.TraceFile != "":
+		exporter, err := trace.NewFileExporter(cfg.TraceFile)
+		if err != nil {
+			log.Fatalf("Cannot write traces: %v", err)
+		}
+		trace.SetExporter(exporter)
+		log.Printf("Writing traces to %s", cfg.TraceFile)
+	case cfg.TraceEndpoint != "":
+		trace.SetExporter(trace.NewCollectorExporter(cfg.TraceEndpoint))
+		log.Printf("Sending traces to %s", cfg.TraceEndpoint)
+	default:
+		return func() {}
+	}
+	return func() { trace.SetExporter(nil) }
+}
+
+// runServe runs the long-lived daemon that owns the WebSocket and serves MCP
+// over HTTP to the stdio proxies
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	idleTimeout := fs.Duration("idle-timeout", defaultIdleTimeout, "exit after this long without connected clients (0 disables)")
+	cfg := loadConfig(fs, args)
+	defer startTracing(cfg)()
 
-	// Create the dynamic node (handles both roles)
-	n := node.New(addr)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	// Start election (determines initial role + monitors)
-	e := election.New(addr, n)
-	e.Start()
+	d := daemon.New(cfg, *idleTimeout)
+	if err := d.Run(ctx); err != nil {
+		log.Fatalf("Daemon failed: %v", err)
+	}
+}
+
+// runStdio forwards MCP over stdin/stdout to the daemon, starting or
+// replacing it first if needed
+func runStdio(args []string) {
+	fs := flag.NewFlagSet("stdio", flag.ExitOnError)
+	cfg := loadConfig(fs, args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := daemon.EnsureRunning(ctx, cfg); err != nil {
+		log.Fatalf("Daemon unavailable: %v", err)
+	}
+	if err := daemon.Proxy(ctx, cfg); err != nil {
+		log.Printf("Proxy stopped: %v", err)
+	}
+}
+
+// runRelay serves the plugin locally and tunnels it to a remote leader. It
+// returns rather than exits on failure, so the session file is closed.
+func runRelay(args []string) error {
+	fs := flag.NewFlagSet("relay", flag.ExitOnError)
+	remote := fs.String("remote", "", "URL of the remote leader, e.g. http://devbox:1994")
+	cfg := loadConfig(fs, args)
+	if *remote == "" {
+		return errors.New("relay needs -remote")
+	}
+	defer startTracing(cfg)()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	b := bridge.NewBridge(cfg.Addr)
+	b.SetOriginCheck(auth.OriginChecker(cfg.AllowedOrigins))
+	if cfg.ReplayFile != "" {
+		if err := b.Replay(cfg.ReplayFile); err != nil {
+			return fmt.Errorf("cannot replay session: %w", err)
+		}
+	}
+	if cfg.RecordFile != "" {
+		if err := b.Record(cfg.RecordFile); err != nil {
+			return fmt.Errorf("cannot record session: %w", err)
+		}
+		defer b.StopRecording()
+	}
+	client := relay.NewClient(*remote, cfg.Token, b, cfg.Timeouts)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go func() {
+		if err := b.Start(); err != nil {
+			cancel(fmt.Errorf("cannot serve the plugin on %s: %w", cfg.Addr, err))
+		}
+	}()
+
+	log.Printf("Relaying plugin on %s to %s", cfg.Addr, *remote)
+	err := client.Run(ctx)
+	b.Stop()
+	if cause := context.Cause(ctx); err == nil && !errors.Is(cause, context.Canceled) {
+		err = cause
+	}
+	return err
+}
+
+// runElection is the classic mode: every editor process runs a node that is
+// either the leader or a follower forwarding to it
+func runElection(args []string) {
+	fs := flag.NewFlagSet("figma-bridge", flag.ExitOnError)
+	transport := fs.String("transport", "stdio", "MCP transport: stdio, http (streamable HTTP at /mcp on the leader) or both")
+	cfg := loadConfig(fs, args)
+
+	useStdio, useHTTP := false, false
+	switch *transport {
+	case "stdio":
+		useStdio = true
+	case "http":
+		useHTTP = true
+	case "both":
+		useStdio, useHTTP = true, true
+	default:
+		log.Fatalf("Unknown transport %q (want stdio, http or both)", *transport)
+	}
+
+	stopTracing := startTracing(cfg)
+
+	srv := server.New(cfg, useHTTP)
+	if err := srv.Start(); err != nil {
+		log.Fatalf("Bridge failed to start: %v", err)
+	}
+
+	shutdown := func() {
+		srv.Stop()
+		stopTracing()
+	}
 
 	// Handle graceful shutdown
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	if !useStdio {
+		log.Printf("Serving MCP over HTTP at /mcp (role: %s)", srv.Role())
+		<-sigCh
+		log.Println("Shutting down...")
+		shutdown()
+		return
+	}
+
 	go func() {
 		<-sigCh
 		log.Println("Shutting down...")
-		e.Stop()
-		n.Stop()
+		shutdown()
 		os.Exit(0)
 	}()
 
-	// MCP tools use the Node as handler - it routes dynamically
-	server := mcp.NewServer(&mcp.Implementation{
-		Name:    "figma-bridge",
-		Version: "0.1.0",
-	}, nil)
-
-	tools := &mcpbridge.Tools{Handler: n}
-	tools.Register(server)
-
-	log.Printf("Starting MCP server (role: %s)", n.Role())
-	if err := server.Run(context.Background(), &mcp.StdioTransport{}); err != nil {
+	log.Printf("Starting MCP server (role: %s)", srv.Role())
+	if err := srv.MCPServer().Run(context.Background(), &mcp.StdioTransport{}); err != nil {
 		log.Printf("MCP server failed: %v", err)
 	}
 }
@@ -0,0 +1,157 @@
+package mcpbridge
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// SessionInfo describes a single connected MCP client session
+type SessionInfo struct {
+	ID            string    `json:"id"`
+	ClientName    string    `json:"clientName,omitempty"`
+	ClientVersion string    `json:"clientVersion,omitempty"`
+	ConnectedAt   time.Time `json:"connectedAt"`
+	LastSeen      time.Time `json:"lastSeen"`
+	ToolCalls     uint64    `json:"toolCalls"`
+}
+
+// Sessions tracks the MCP client sessions connected to a server.
+// With stdio there is a single session; with streamable HTTP every client
+// that connects gets its own entry, keyed by its Mcp-Session-Id.
+type Sessions struct {
+	mu         sync.Mutex
+	sessions   map[*mcp.ServerSession]*SessionInfo
+	lastActive time.Time
+}
+
+// NewSessions creates an empty session tracker
+func NewSessions() *Sessions {
+	return &Sessions{
+		sessions:   make(map[*mcp.ServerSession]*SessionInfo),
+		lastActive: time.Now(),
+	}
+}
+
+// Middleware returns receiving middleware that records session activity.
+// Install it with server.AddReceivingMiddleware.
+func (s *Sessions) Middleware() mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			result, err := next(ctx, method, req)
+			if ss, ok := req.GetSession().(*mcp.ServerSession); ok {
+				s.touch(ss, method)
+			}
+			return result, err
+		}
+	}
+}
+
+// List returns a snapshot of all live sessions, oldest first
+func (s *Sessions) List() []SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]SessionInfo, 0, len(s.sessions))
+	for _, info := range s.sessions {
+		list = append(list, *info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ConnectedAt.Before(list[j].ConnectedAt)
+	})
+	return list
+}
+
+// ClientNames returns the names of the connected clients, oldest first
+func (s *Sessions) ClientNames() []string {
+	var names []string
+	for _, info := range s.List() {
+		if info.ClientName != "" {
+			names = append(names, info.ClientName)
+		}
+	}
+	return names
+}
+
+// Len returns the number of live sessions
+func (s *Sessions) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// Idle returns how long there have been no live sessions, or zero while at
+// least one client is connected
+func (s *Sessions) Idle() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.sessions) > 0 {
+		return 0
+	}
+	return time.Since(s.lastActive)
+}
+
+// Expire closes the sessions that sent no request for maxAge. Streamable
+// HTTP clients that go away without a DELETE would otherwise count as
+// connected forever.
+func (s *Sessions) Expire(maxAge time.Duration) int {
+	now := time.Now()
+	var stale []*mcp.ServerSession
+
+	s.mu.Lock()
+	for ss, info := range s.sessions {
+		if now.Sub(info.LastSeen) >= maxAge {
+			stale = append(stale, ss)
+			delete(s.sessions, ss)
+		}
+	}
+	if len(stale) > 0 {
+		s.lastActive = now
+	}
+	s.mu.Unlock()
+
+	for _, ss := range stale {
+		_ = ss.Close()
+	}
+	return len(stale)
+}
+
+func (s *Sessions) touch(ss *mcp.ServerSession, method string) {
+	now := time.Now()
+
+	s.mu.Lock()
+	info, ok := s.sessions[ss]
+	if !ok {
+		info = &SessionInfo{
+			ID:          ss.ID(),
+			ConnectedAt: now,
+		}
+		s.sessions[ss] = info
+		go s.forgetOnClose(ss)
+	}
+	info.LastSeen = now
+	s.lastActive = now
+	if method == "tools/call" {
+		info.ToolCalls++
+	}
+	if info.ClientName == "" {
+		if params := ss.InitializeParams(); params != nil && params.ClientInfo != nil {
+			info.ClientName = params.ClientInfo.Name
+			info.ClientVersion = params.ClientInfo.Version
+		}
+	}
+	s.mu.Unlock()
+}
+
+func (s *Sessions) forgetOnClose(ss *mcp.ServerSession) {
+	_ = ss.Wait()
+	s.mu.Lock()
+	if _, ok := s.sessions[ss]; ok {
+		delete(s.sessions, ss)
+		s.lastActive = time.Now()
+	}
+	s.mu.Unlock()
+}
@@ -3,10 +3,14 @@ package mcpbridge
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 
 	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/leader"
+	"figma-mcp-bridge-v2/trace"
 )
 
 // ToolHandler abstracts the bridge communication.
@@ -16,8 +20,18 @@ type ToolHandler interface {
 	SendWithParams(ctx context.Context, requestType string, nodeIDs []string, params map[string]interface{}) (bridge.Response, error)
 }
 
+// StatusProvider is implemented by handlers that can report the state of
+// the bridge cluster. When the handler implements it, Register also adds
+// the get_bridge_status tool.
+type StatusProvider interface {
+	ClusterStatus(ctx context.Context) (leader.ClusterStatus, error)
+}
+
 type Tools struct {
 	Handler ToolHandler
+	// Timeouts overrides how long each tool waits for Figma; a call's own
+	// timeout argument wins over both
+	Timeouts bridge.Timeouts
 }
 
 func (t *Tools) Register(server *mcp.Server) {
@@ -60,92 +74,108 @@ func (t *Tools) Register(server *mcp.Server) {
 		Name:        "get_screenshot",
 		Description: "Export a screenshot of the selected nodes or specific nodes by ID. Returns base64-encoded image data.",
 	}, t.handleGetScreenshot)
+
+	if _, ok := t.Handler.(StatusProvider); ok {
+		mcp.AddTool(server, &mcp.Tool{
+			Name:        "get_bridge_status",
+			Description: "Get the status of the Figma bridge: leader, connected followers, plugin connection and pending requests. Useful to diagnose why other tools fail.",
+		}, t.handleGetBridgeStatus)
+	}
+}
+
+// timeoutArgs are the arguments of tools that take nothing but a timeout.
+// Every tool that asks Figma accepts the same timeout.
+type timeoutArgs struct {
+	Timeout float64 `json:"timeout,omitempty" jsonschema:"optional seconds to wait for Figma before giving up (default depends on the tool, at most 600)"`
 }
 
 type getNodeArgs struct {
-	NodeID string `json:"nodeId" jsonschema:"the node ID to fetch"`
+	NodeID  string  `json:"nodeId" jsonschema:"the node ID to fetch"`
+	Timeout float64 `json:"timeout,omitempty" jsonschema:"optional seconds to wait for Figma before giving up (default depends on the tool, at most 600)"`
 }
 
 type getDesignContextArgs struct {
-	Depth int `json:"depth,omitempty" jsonschema:"how many levels deep to traverse the node tree (default 2)"`
+	Depth   int     `json:"depth,omitempty" jsonschema:"how many levels deep to traverse the node tree (default 2)"`
+	Timeout float64 `json:"timeout,omitempty" jsonschema:"optional seconds to wait for Figma before giving up (default depends on the tool, at most 600)"`
 }
 
 type getScreenshotArgs struct {
 	NodeIDs []string `json:"nodeIds,omitempty" jsonschema:"optional list of node IDs to export - if empty exports the current selection"`
 	Format  string   `json:"format,omitempty" jsonschema:"export format: PNG (default) or SVG or JPG or PDF"`
 	Scale   float64  `json:"scale,omitempty" jsonschema:"export scale for raster formats (default 2)"`
+	Timeout float64  `json:"timeout,omitempty" jsonschema:"optional seconds to wait for Figma before giving up (default depends on the tool, at most 600)"`
 }
 
 func (t *Tools) handleGetDocument(
 	ctx context.Context,
-	_ *mcp.CallToolRequest,
-	_ struct{},
+	req *mcp.CallToolRequest,
+	args timeoutArgs,
 ) (*mcp.CallToolResult, any, error) {
-	resp, err := t.Handler.Send(ctx, "get_document", nil)
+	resp, err := t.send(ctx, req, args.Timeout, "get_document", nil, nil)
 	return renderResponse(resp, err)
 }
 
 func (t *Tools) handleGetSelection(
 	ctx context.Context,
-	_ *mcp.CallToolRequest,
-	_ struct{},
+	req *mcp.CallToolRequest,
+	args timeoutArgs,
 ) (*mcp.CallToolResult, any, error) {
-	resp, err := t.Handler.Send(ctx, "get_selection", nil)
+	resp, err := t.send(ctx, req, args.Timeout, "get_selection", nil, nil)
 	return renderResponse(resp, err)
 }
 
 func (t *Tools) handleGetNode(
 	ctx context.Context,
-	_ *mcp.CallToolRequest,
+	req *mcp.CallToolRequest,
 	args getNodeArgs,
 ) (*mcp.CallToolResult, any, error) {
-	resp, err := t.Handler.Send(ctx, "get_node", []string{args.NodeID})
+	resp, err := t.send(ctx, req, args.Timeout, "get_node", []string{args.NodeID}, nil)
 	return renderResponse(resp, err)
 }
 
 func (t *Tools) handleGetStyles(
 	ctx context.Context,
-	_ *mcp.CallToolRequest,
-	_ struct{},
+	req *mcp.CallToolRequest,
+	args timeoutArgs,
 ) (*mcp.CallToolResult, any, error) {
-	resp, err := t.Handler.Send(ctx, "get_styles", nil)
+	resp, err := t.send(ctx, req, args.Timeout, "get_styles", nil, nil)
 	return renderResponse(resp, err)
 }
 
 func (t *Tools) handleGetMetadata(
 	ctx context.Context,
-	_ *mcp.CallToolRequest,
-	_ struct{},
+	req *mcp.CallToolRequest,
+	args timeoutArgs,
 ) (*mcp.CallToolResult, any, error) {
-	resp, err := t.Handler.Send(ctx, "get_metadata", nil)
+	resp, err := t.send(ctx, req, args.Timeout, "get_metadata", nil, nil)
 	return renderResponse(resp, err)
 }
 
 func (t *Tools) handleGetDesignContext(
 	ctx context.Context,
-	_ *mcp.CallToolRequest,
+	req *mcp.CallToolRequest,
 	args getDesignContextArgs,
 ) (*mcp.CallToolResult, any, error) {
 	params := make(map[string]interface{})
 	if args.Depth > 0 {
 		params["depth"] = args.Depth
 	}
-	resp, err := t.Handler.SendWithParams(ctx, "get_design_context", nil, params)
+	resp, err := t.send(ctx, req, args.Timeout, "get_design_context", nil, params)
 	return renderResponse(resp, err)
 }
 
 func (t *Tools) handleGetVariableDefs(
 	ctx context.Context,
-	_ *mcp.CallToolRequest,
-	_ struct{},
+	req *mcp.CallToolRequest,
+	args timeoutArgs,
 ) (*mcp.CallToolResult, any, error) {
-	resp, err := t.Handler.Send(ctx, "get_variable_defs", nil)
+	resp, err := t.send(ctx, req, args.Timeout, "get_variable_defs", nil, nil)
 	return renderResponse(resp, err)
 }
 
 func (t *Tools) handleGetScreenshot(
 	ctx context.Context,
-	_ *mcp.CallToolRequest,
+	req *mcp.CallToolRequest,
 	args getScreenshotArgs,
 ) (*mcp.CallToolResult, any, error) {
 	params := make(map[string]interface{})
@@ -155,18 +185,59 @@ func (t *Tools) handleGetScreenshot(
 	if args.Scale > 0 {
 		params["scale"] = args.Scale
 	}
-	resp, err := t.Handler.SendWithParams(ctx, "get_screenshot", args.NodeIDs, params)
+	resp, err := t.send(ctx, req, args.Timeout, "get_screenshot", args.NodeIDs, params)
 	return renderResponse(resp, err)
 }
 
+func (t *Tools) handleGetBridgeStatus(
+	ctx context.Context,
+	_ *mcp.CallToolRequest,
+	_ struct{},
+) (*mcp.CallToolResult, any, error) {
+	status, err := t.Handler.(StatusProvider).ClusterStatus(ctx)
+	return renderResponse(bridge.Response{Data: status}, err)
+}
+
+// send forwards a tool call to the handler as the root span of its trace,
+// tagged with the MCP session it came from. The call waits as long as its
+// arguments or the tool's timeout say, and reports the plugin's progress
+// if the client asked for it.
+func (t *Tools) send(ctx context.Context, req *mcp.CallToolRequest, timeoutSeconds float64, requestType string, nodeIDs []string, params map[string]interface{}) (bridge.Response, error) {
+	timeout := t.Timeouts.For(requestType)
+	if timeoutSeconds > 0 {
+		timeout = bridge.ClampTimeout(time.Duration(timeoutSeconds * float64(time.Second)))
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if req != nil && req.Session != nil {
+		ctx = bridge.WithOrigin(ctx, bridge.Origin{Session: req.Session.ID()})
+		if req.Params != nil && req.Params.GetProgressToken() != nil {
+			ctx = bridge.WithProgress(ctx, notifyProgress(ctx, req.Session, req.Params.GetProgressToken()))
+		}
+	}
+	ctx, span := trace.Start(ctx, "tool "+requestType, trace.KindServer)
+	resp, err := t.Handler.SendWithParams(ctx, requestType, nodeIDs, params)
+	span.End(err)
+	return resp, err
+}
+
+// notifyProgress sends plugin progress to the MCP client as notifications
+// for token
+func notifyProgress(ctx context.Context, session *mcp.ServerSession, token any) func(bridge.Progress) {
+	return func(p bridge.Progress) {
+		_ = session.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+			ProgressToken: token,
+			Progress:      p.Progress,
+			Total:         p.Total,
+			Message:       p.Message,
+		})
+	}
+}
+
 func renderResponse(resp bridge.Response, err error) (*mcp.CallToolResult, any, error) {
 	if err != nil {
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: err.Error()},
-			},
-			IsError: true,
-		}, nil, nil
+		return renderError(err), nil, nil
 	}
 
 	payload, marshalErr := json.Marshal(resp.Data)
@@ -185,3 +256,24 @@ func renderResponse(resp bridge.Response, err error) (*mcp.CallToolResult, any,
 		},
 	}, nil, nil
 }
+
+// renderError reports err with its code so agents can tell whether to
+// retry, e.g. "plugin not connected [not_connected, retryable] Open the ..."
+func renderError(err error) *mcp.CallToolResult {
+	code := bridge.CodeOf(err)
+	retry := "not retryable"
+	if code.Retryable() {
+		retry = "retryable"
+	}
+	text := fmt.Sprintf("%s [%s, %s]", err.Error(), code, retry)
+	if hint := code.Hint(); hint != "" {
+		text += " " + hint
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: text},
+		},
+		Meta:    mcp.Meta{"code": string(code), "retryable": code.Retryable()},
+		IsError: true,
+	}
+}
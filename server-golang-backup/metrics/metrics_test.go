@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteTextFormat(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("requests_total", "Requests served.", "tool", "code")
+	sizes := r.Histogram("response_bytes", "Response sizes.", []float64{10, 100}, "tool")
+	plain := r.Counter("restarts_total", "Restarts.")
+
+	requests.Inc("get_node", "ok")
+	requests.Add(2, "get_document", "timeout")
+	sizes.Observe(5, "get_node")
+	sizes.Observe(50, "get_node")
+	sizes.Observe(500, "get_node")
+	plain.Inc()
+
+	var out strings.Builder
+	r.Write(&out)
+	WriteGauge(&out, "epoch", "Leader epoch.", 3)
+	WriteHeader(&out, "connected", "Plugin connected.", "gauge")
+	WriteSample(&out, "connected", 1, "via", "direct")
+	WriteSample(&out, "connected", 0, "via", "relay")
+
+	want := `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{tool="get_document",code="timeout"} 2
+requests_total{tool="get_node",code="ok"} 1
+# HELP response_bytes Response sizes.
+# TYPE response_bytes histogram
+response_bytes_bucket{tool="get_node",le="10"} 1
+response_bytes_bucket{tool="get_node",le="100"} 2
+response_bytes_bucket{tool="get_node",le="+Inf"} 3
+response_bytes_sum{tool="get_node"} 555
+response_bytes_count{tool="get_node"} 3
+# HELP restarts_total Restarts.
+# TYPE restarts_total counter
+restarts_total 1
+# HELP epoch Leader epoch.
+# TYPE epoch gauge
+epoch 3
+# HELP connected Plugin connected.
+# TYPE connected gauge
+connected{via="direct"} 1
+connected{via="relay"} 0
+`
+	if got := out.String(); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLabelValuesAreEscaped(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("clients_total", "Clients.", "client")
+	c.Inc(`Claude "Desktop"`)
+	c.Inc("C:\\tools\\figma")
+	c.Inc("two\nlines")
+
+	var out strings.Builder
+	r.Write(&out)
+	WriteSample(&out, "follower", 1, "client", `a"b\c`+"\n")
+
+	for _, want := range []string{
+		`clients_total{client="Claude \"Desktop\""} 1`,
+		`clients_total{client="C:\\tools\\figma"} 1`,
+		`clients_total{client="two\nlines"} 1`,
+		`follower{client="a\"b\\c\n"} 1`,
+	} {
+		if !strings.Contains(out.String(), want+"\n") {
+			t.Errorf("output lacks %s:\n%s", want, out.String())
+		}
+	}
+}
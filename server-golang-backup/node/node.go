@@ -2,10 +2,18 @@ package node
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"log"
+	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/config"
 	"figma-mcp-bridge-v2/follower"
 	"figma-mcp-bridge-v2/leader"
 )
@@ -33,21 +41,81 @@ func (r Role) String() string {
 // Node is the dynamic handler that switches between leader and follower roles.
 // It implements the ToolHandler interface used by MCP tools.
 type Node struct {
+	id       string
 	mu       sync.RWMutex
 	role     Role
 	leader   *leader.Leader
 	follower *follower.Follower
-	addr     string
+	cfg      config.Config
+	mcp      http.Handler
+	clients  func() []string
+	onLost   func()
+	stopHB   context.CancelFunc
 }
 
-// New creates a new Node instance
-func New(addr string) *Node {
+// New creates a new Node that listens on cfg.Addr when leader and finds the
+// leader through cfg.Locator when follower
+func New(cfg config.Config) *Node {
+	id := newID()
 	return &Node{
-		addr:     addr,
-		follower: follower.New("http://localhost:1994"),
+		id:       id,
+		cfg:      cfg,
+		follower: follower.New(cfg.Locator(), id),
 	}
 }
 
+// SetClients tells the node how to list its MCP clients, which it reports
+// in heartbeats and the cluster status. It must be called before the
+// election starts.
+func (n *Node) SetClients(clients func() []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.clients = clients
+}
+
+// ClusterStatus returns the leader's view of the cluster, asking the leader
+// over HTTP when this node is a follower
+func (n *Node) ClusterStatus(ctx context.Context) (leader.ClusterStatus, error) {
+	n.mu.RLock()
+	l := n.leader
+	f := n.follower
+	n.mu.RUnlock()
+
+	if l != nil {
+		return l.ClusterStatus(), nil
+	}
+	return f.ClusterStatus(ctx)
+}
+
+// OnLeaderLost sets a callback run when a request fails because the leader
+// is gone, typically Election.CheckNow so the vacancy is noticed right away.
+// It must be called before the election starts.
+func (n *Node) OnLeaderLost(fn func()) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.onLost = fn
+}
+
+// ServeMCP makes the node expose MCP over streamable HTTP at /mcp whenever
+// it holds the leader role. It must be called before the election starts.
+func (n *Node) ServeMCP(handler http.Handler) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.mcp = handler
+}
+
+// WatchLeader waits for the leader to announce its handoff on the follower
+// link, for the election
+func (n *Node) WatchLeader(ctx context.Context) (leader.WatchEvent, error) {
+	return n.follower.Watch(ctx)
+}
+
+// ID returns the random identifier of this node, used by the leader to
+// designate a successor
+func (n *Node) ID() string {
+	return n.id
+}
+
 // Role returns the current role of this node
 func (n *Node) Role() Role {
 	n.mu.RLock()
@@ -65,17 +133,24 @@ func (n *Node) Send(ctx context.Context, requestType string, nodeIDs []string) (
 	return n.SendWithParams(ctx, requestType, nodeIDs, nil)
 }
 
-// SendWithParams implements ToolHandler - routes request based on current role
+// SendWithParams implements ToolHandler - routes request based on current
+// role, retrying while leadership changes hands (see retry.go)
 func (n *Node) SendWithParams(ctx context.Context, requestType string, nodeIDs []string, params map[string]interface{}) (bridge.Response, error) {
+	return n.sendWithRetry(ctx, requestType, nodeIDs, params)
+}
+
+// dispatch sends one attempt of a request, locally or via the leader
+func (n *Node) dispatch(ctx context.Context, requestType string, nodeIDs []string, params map[string]interface{}) (bridge.Response, error) {
 	n.mu.RLock()
 	role := n.role
 	l := n.leader
 	f := n.follower
 	n.mu.RUnlock()
 
+	ctx = bridge.WithOrigin(ctx, bridge.Origin{Node: n.id})
 	// Dynamic dispatch based on CURRENT role
 	if role == RoleLeader && l != nil {
-		return l.Bridge().SendWithParams(ctx, requestType, nodeIDs, params)
+		return l.SendWithParams(ctx, requestType, nodeIDs, params)
 	}
 	return f.SendWithParams(ctx, requestType, nodeIDs, params)
 }
@@ -88,46 +163,145 @@ func (n *Node) BecomeLeader() error {
 	if n.role == RoleLeader {
 		return nil // already leader
 	}
+	if n.cfg.Role == config.RoleFollower {
+		return errors.New("node is pinned to the follower role")
+	}
 
 	// Start the leader (bridge + HTTP server)
-	l := leader.New(n.addr)
+	l := leader.New(n.cfg.Addr, leader.Options{
+		Token:          n.cfg.Token,
+		AllowedOrigins: n.cfg.AllowedOrigins,
+		EpochFile:      n.cfg.EpochFile,
+		LockFile:       n.cfg.LockFile,
+		RecordFile:     n.cfg.RecordFile,
+		ReplayFile:     n.cfg.ReplayFile,
+		MinEpoch:       n.follower.SeenEpoch(),
+		StepDown:       n.stepDown(),
+		Clients:        n.clients,
+		Timeouts:       n.cfg.Timeouts,
+	})
+	if n.mcp != nil {
+		l.Handle("/mcp", n.mcp)
+	}
 	if err := l.Start(); err != nil {
 		return err
 	}
 
+	n.stopHeartbeat()
+	n.follower.Close()
 	n.leader = l
 	n.role = RoleLeader
 	log.Println("Became LEADER")
 	return nil
 }
 
+// Fenced reports whether this node is a leader that has been superseded by
+// a leader with a higher epoch
+func (n *Node) Fenced() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.leader != nil && n.leader.Fenced()
+}
+
+// SelfCheck runs the leader's health checks and returns an error if it
+// should step down. Followers have nothing to check.
+func (n *Node) SelfCheck() error {
+	n.mu.RLock()
+	l := n.leader
+	n.mu.RUnlock()
+	if l == nil {
+		return nil
+	}
+	return l.SelfCheck()
+}
+
 // BecomeFollower transitions this node to the follower role
 func (n *Node) BecomeFollower() {
 	n.mu.Lock()
-	defer n.mu.Unlock()
-
 	if n.role == RoleFollower {
+		n.mu.Unlock()
 		return
 	}
-
-	// Stop leader if we were one
-	if n.leader != nil {
-		n.leader.Stop()
-		n.leader = nil
+	if n.cfg.Role == config.RoleLeader && n.role == RoleLeader {
+		n.mu.Unlock()
+		log.Println("Node is pinned to the leader role, not stepping down")
+		return
 	}
 
+	l := n.leader
+	n.leader = nil
 	n.role = RoleFollower
+	n.startHeartbeat()
+	n.mu.Unlock()
+
+	// Stop the leader we were without the lock: it drains in-flight
+	// requests for a while, and status readers must not wait on that
+	if l != nil {
+		l.Stop()
+	}
 	log.Println("Became FOLLOWER")
 }
 
+// stepDown returns what the leader calls when a newer node asks to take
+// over, or nil if this node is pinned to the leader role
+func (n *Node) stepDown() func() {
+	if n.cfg.Role == config.RoleLeader {
+		return nil
+	}
+	return n.BecomeFollower
+}
+
+// startHeartbeat registers with the leader and keeps the registration fresh
+// while we are a follower. Caller must hold n.mu.
+func (n *Node) startHeartbeat() {
+	ctx, cancel := context.WithCancel(context.Background())
+	n.stopHB = cancel
+
+	go func() {
+		ticker := time.NewTicker(leader.HeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			client := ""
+			if n.clients != nil {
+				client = strings.Join(n.clients(), ", ")
+			}
+			_ = n.follower.Heartbeat(ctx, client)
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// stopHeartbeat stops the heartbeat loop, if running. Caller must hold n.mu.
+func (n *Node) stopHeartbeat() {
+	if n.stopHB != nil {
+		n.stopHB()
+		n.stopHB = nil
+	}
+}
+
 // Stop gracefully stops the node
 func (n *Node) Stop() {
 	n.mu.Lock()
-	defer n.mu.Unlock()
+	n.stopHeartbeat()
+	l := n.leader
+	n.leader = nil
+	n.role = RoleUnknown
+	n.mu.Unlock()
 
-	if n.leader != nil {
-		n.leader.Stop()
-		n.leader = nil
+	if l != nil {
+		l.Stop()
 	}
-	n.role = RoleUnknown
+}
+
+func newID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(buf)
 }
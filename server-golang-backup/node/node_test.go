@@ -0,0 +1,105 @@
+package node
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"figma-mcp-bridge-v2/auth"
+	"figma-mcp-bridge-v2/config"
+	"figma-mcp-bridge-v2/leader"
+)
+
+// testConfig is a configuration with role on a free port, with its state
+// kept in a temporary directory
+func testConfig(t *testing.T, role string) config.Config {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	dir := t.TempDir()
+	return config.Config{
+		Addr:           addr,
+		LeaderURL:      config.BaseURL(addr),
+		Token:          "test-token",
+		Role:           role,
+		AllowedOrigins: auth.DefaultOrigins,
+		EpochFile:      filepath.Join(dir, "epoch"),
+		LockFile:       filepath.Join(dir, "run", "leader.lock"),
+	}
+}
+
+func TestPinnedFollowerNeverLeads(t *testing.T) {
+	cfg := testConfig(t, config.RoleFollower)
+	n := New(cfg)
+	t.Cleanup(n.Stop)
+	n.BecomeFollower()
+
+	// No leader anywhere, which would make an unpinned node take over
+	if err := n.BecomeLeader(); err == nil {
+		t.Fatal("pinned follower became leader")
+	}
+	if role := n.Role(); role != RoleFollower {
+		t.Fatalf("role = %s, want FOLLOWER", role)
+	}
+	ln, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		t.Fatalf("pinned follower holds the leader's port: %v", err)
+	}
+	ln.Close()
+}
+
+func TestPinnedLeaderNeverStepsDown(t *testing.T) {
+	for _, tt := range []struct {
+		role     string
+		stepDown bool
+	}{
+		{config.RoleAuto, true},
+		{config.RoleLeader, false},
+	} {
+		t.Run(tt.role, func(t *testing.T) {
+			cfg := testConfig(t, tt.role)
+			n := New(cfg)
+			t.Cleanup(n.Stop)
+			if err := n.BecomeLeader(); err != nil {
+				t.Fatal(err)
+			}
+
+			// A newer node asking to take over is the one way a healthy
+			// leader is asked to leave
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := leader.RequestTakeover(ctx, http.DefaultClient, cfg.LeaderURL, cfg.Token, leader.TakeoverRequest{
+				ID:          "newer",
+				Version:     "99.0.0",
+				Protocol:    leader.Protocol,
+				MinProtocol: leader.MinProtocol,
+			})
+			if (err == nil) != tt.stepDown {
+				t.Fatalf("takeover err = %v, want accepted %v", err, tt.stepDown)
+			}
+			if !tt.stepDown {
+				// The election steps leaders down through BecomeFollower
+				n.BecomeFollower()
+				if role := n.Role(); role != RoleLeader {
+					t.Fatalf("pinned leader stepped down, role %s", role)
+				}
+				return
+			}
+			for n.Role() != RoleFollower {
+				select {
+				case <-ctx.Done():
+					t.Fatalf("leader did not step down for a newer node, role %s", n.Role())
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+		})
+	}
+}
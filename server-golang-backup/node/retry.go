@@ -0,0 +1,98 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/follower"
+)
+
+const (
+	// How long a request keeps retrying while no leader is reachable; long
+	// enough to cover a missed handoff and one election tick
+	retryBudget = 10 * time.Second
+
+	retryInitialDelay = 100 * time.Millisecond
+	retryMaxDelay     = time.Second
+)
+
+// now and after are replaced in tests so retries take no real time
+var (
+	now   = time.Now
+	after = time.After
+)
+
+// idempotent lists the requests that only read from Figma and so can be
+// replayed when the leader died with the request in flight. Anything not
+// listed is retried only if it provably never reached the leader.
+var idempotent = map[string]bool{
+	"get_document":       true,
+	"get_selection":      true,
+	"get_node":           true,
+	"get_styles":         true,
+	"get_metadata":       true,
+	"get_design_context": true,
+	"get_variable_defs":  true,
+	"get_screenshot":     true,
+}
+
+// sendWithRetry dispatches a request and, when the leader is unreachable,
+// triggers an immediate election check and retries it, see Retry
+func (n *Node) sendWithRetry(ctx context.Context, requestType string, nodeIDs []string, params map[string]interface{}) (bridge.Response, error) {
+	return Retry(ctx, requestType, func() (bridge.Response, error) {
+		return n.dispatch(ctx, requestType, nodeIDs, params)
+	}, n.leaderLost)
+}
+
+// Retry makes attempts at a request with send and, while the leader is
+// unreachable, calls lost and retries with backoff until a new leader
+// answers or the budget runs out. Only requests that provably never
+// reached the leader, or idempotent ones, are sent again.
+func Retry(ctx context.Context, requestType string, send func() (bridge.Response, error), lost func()) (bridge.Response, error) {
+	deadline := now().Add(retryBudget)
+	delay := retryInitialDelay
+
+	for attempt := 1; ; attempt++ {
+		resp, err := send()
+		if !retryable(requestType, err) || now().Add(delay).After(deadline) {
+			return resp, err
+		}
+		if attempt == 1 {
+			log.Printf("Leader unavailable for %s, retrying: %v", requestType, err)
+		}
+
+		if lost != nil {
+			lost()
+		}
+		select {
+		case <-ctx.Done():
+			return resp, err
+		case <-after(delay):
+		}
+		delay = min(delay*2, retryMaxDelay)
+	}
+}
+
+// retryable reports whether a failed request may be sent again
+func retryable(requestType string, err error) bool {
+	switch {
+	case errors.Is(err, follower.ErrLeaderUnavailable):
+		return true
+	case errors.Is(err, follower.ErrLeaderLost):
+		return idempotent[requestType]
+	default:
+		return false
+	}
+}
+
+func (n *Node) leaderLost() {
+	n.mu.RLock()
+	fn := n.onLost
+	n.mu.RUnlock()
+	if fn != nil {
+		fn()
+	}
+}
@@ -0,0 +1,158 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/follower"
+)
+
+// fakeTime stands in for now and after: every wait returns at once and
+// moves the clock forward by the delay asked for
+type fakeTime struct {
+	now   time.Time
+	slept []time.Duration
+	// block makes waits never return, so only ctx can end them
+	block bool
+}
+
+func useFakeTime(t *testing.T) *fakeTime {
+	ft := &fakeTime{now: time.Unix(0, 0)}
+	realNow, realAfter := now, after
+	now = func() time.Time { return ft.now }
+	after = func(d time.Duration) <-chan time.Time {
+		ft.slept = append(ft.slept, d)
+		if ft.block {
+			return nil
+		}
+		ft.now = ft.now.Add(d)
+		ch := make(chan time.Time, 1)
+		ch <- ft.now
+		return ch
+	}
+	t.Cleanup(func() { now, after = realNow, realAfter })
+	return ft
+}
+
+// failing returns a send that fails with errs in turn and then succeeds,
+// and counts its calls
+func failing(errs ...error) (func() (bridge.Response, error), *int) {
+	calls := 0
+	return func() (bridge.Response, error) {
+		calls++
+		if calls <= len(errs) {
+			return bridge.Response{}, errs[calls-1]
+		}
+		return bridge.Response{Type: "ok"}, nil
+	}, &calls
+}
+
+func TestRetryLeaderLost(t *testing.T) {
+	useFakeTime(t)
+	lost := fmt.Errorf("%w: link closed", follower.ErrLeaderLost)
+
+	tests := []struct {
+		requestType string
+		calls       int
+		wantErr     bool
+	}{
+		// Reads are safe to replay on the next leader
+		{"get_node", 2, false},
+		// Anything else may have run on the old leader; sending it again
+		// could apply it twice
+		{"create_frame", 1, true},
+		{"set_text", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.requestType, func(t *testing.T) {
+			send, calls := failing(lost)
+			losts := 0
+			_, err := Retry(context.Background(), tt.requestType, send, func() { losts++ })
+			if *calls != tt.calls {
+				t.Fatalf("sent %d times, want %d", *calls, tt.calls)
+			}
+			if tt.wantErr != errors.Is(err, follower.ErrLeaderLost) {
+				t.Fatalf("err = %v", err)
+			}
+			if losts != tt.calls-1 {
+				t.Fatalf("lost called %d times for %d retries", losts, tt.calls-1)
+			}
+		})
+	}
+}
+
+func TestRetryUnavailableUntilBudget(t *testing.T) {
+	ft := useFakeTime(t)
+	unavailable := fmt.Errorf("%w: connection refused", follower.ErrLeaderUnavailable)
+
+	// Never sent, so even a write is retried for the whole budget
+	calls := 0
+	_, err := Retry(context.Background(), "set_text", func() (bridge.Response, error) {
+		calls++
+		return bridge.Response{}, unavailable
+	}, nil)
+	if !errors.Is(err, follower.ErrLeaderUnavailable) {
+		t.Fatalf("err = %v, want the last unavailable error", err)
+	}
+	if calls != len(ft.slept)+1 {
+		t.Fatalf("%d attempts for %d waits", calls, len(ft.slept))
+	}
+
+	var total time.Duration
+	for i, d := range ft.slept {
+		if d > retryMaxDelay {
+			t.Fatalf("wait %d is %s, above the %s cap", i, d, retryMaxDelay)
+		}
+		if i > 0 && d < ft.slept[i-1] {
+			t.Fatalf("waits shrink: %v", ft.slept)
+		}
+		total += d
+	}
+	if ft.slept[0] != retryInitialDelay || ft.slept[len(ft.slept)-1] != retryMaxDelay {
+		t.Fatalf("waits = %v, want %s up to the %s cap", ft.slept, retryInitialDelay, retryMaxDelay)
+	}
+	if total > retryBudget || total <= retryBudget-retryMaxDelay {
+		t.Fatalf("retried for %s, want just under the %s budget", total, retryBudget)
+	}
+}
+
+func TestRetryRecovers(t *testing.T) {
+	ft := useFakeTime(t)
+	unavailable := fmt.Errorf("%w: connection refused", follower.ErrLeaderUnavailable)
+
+	send, calls := failing(unavailable, unavailable)
+	resp, err := Retry(context.Background(), "set_text", send, nil)
+	if err != nil || resp.Type != "ok" || *calls != 3 {
+		t.Fatalf("got %+v, %v after %d calls; want success on the third", resp, err, *calls)
+	}
+	if want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}; len(ft.slept) != 2 || ft.slept[0] != want[0] || ft.slept[1] != want[1] {
+		t.Fatalf("waits = %v, want %v", ft.slept, want)
+	}
+}
+
+func TestRetryStopsWhenCancelled(t *testing.T) {
+	ft := useFakeTime(t)
+	ft.block = true
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	send, calls := failing(follower.ErrLeaderUnavailable)
+	_, err := Retry(ctx, "get_node", send, nil)
+	if *calls != 1 || !errors.Is(err, follower.ErrLeaderUnavailable) {
+		t.Fatalf("sent %d times, err %v; want one attempt and its error", *calls, err)
+	}
+}
+
+func TestRetryOtherErrors(t *testing.T) {
+	useFakeTime(t)
+	notFound := bridge.NewError(bridge.CodeNodeNotFound, "Node not found: 9:9")
+
+	send, calls := failing(notFound)
+	if _, err := Retry(context.Background(), "get_node", send, nil); *calls != 1 || !errors.Is(err, notFound) {
+		t.Fatalf("sent %d times, err %v; plugin errors are not the leader's to retry", *calls, err)
+	}
+}
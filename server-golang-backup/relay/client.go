@@ -0,0 +1,225 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/link"
+	"figma-mcp-bridge-v2/trace"
+)
+
+const (
+	// Reconnect backoff after the tunnel drops
+	minReconnectDelay = 250 * time.Millisecond
+	maxReconnectDelay = 10 * time.Second
+)
+
+var (
+	errBadToken = errors.New("remote rejected our token; check -token")
+	errHandoff  = errors.New("remote leader is handing off")
+)
+
+// Client is the relay process's end of the tunnel. It serves the plugin
+// through a local bridge and runs the remote leader's requests on it.
+type Client struct {
+	remoteURL string
+	token     string
+	bridge    *bridge.Bridge
+	timeouts  bridge.Timeouts
+
+	mu   sync.Mutex
+	conn *websocket.Conn // current tunnel, nil between connections
+	wmu  sync.Mutex
+}
+
+// NewClient creates a relay that connects b to the leader at remoteURL,
+// authenticating with token. Requests that carry no deadline of their own
+// wait for the plugin as long as timeouts says. It must be created before b
+// serves the plugin.
+func NewClient(remoteURL, token string, b *bridge.Bridge, timeouts bridge.Timeouts) *Client {
+	c := &Client{
+		remoteURL: strings.TrimSuffix(remoteURL, "/"),
+		token:     token,
+		bridge:    b,
+		timeouts:  timeouts,
+	}
+	b.SetConnectionHook(func(connected bool) {
+		_ = c.send(pluginEvent(connected))
+	})
+	return c
+}
+
+// Run keeps a tunnel to the remote leader open until ctx ends, reconnecting
+// with backoff. It only returns early if the remote rejects the token.
+func (c *Client) Run(ctx context.Context) error {
+	delay := minReconnectDelay
+	for {
+		started := time.Now()
+		err := c.runTunnel(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, errBadToken) {
+			return err
+		}
+
+		switch {
+		case errors.Is(err, errHandoff):
+			// A successor is about to bind; come back quickly
+			delay = minReconnectDelay
+		case time.Since(started) > maxReconnectDelay:
+			// The tunnel was healthy for a while, start backing off anew
+			delay = minReconnectDelay
+		}
+		log.Printf("Relay tunnel down (%v), reconnecting in %s", err, delay)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// runTunnel serves one tunnel until it closes
+func (c *Client) runTunnel(ctx context.Context) error {
+	wsURL := "ws" + strings.TrimPrefix(c.remoteURL, "http") + Path
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+c.token)
+
+	dialer := websocket.Dialer{HandshakeTimeout: 10 * time.Second}
+	conn, resp, err := dialer.DialContext(ctx, wsURL, header)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			return errBadToken
+		}
+		return fmt.Errorf("failed to reach %s: %w", c.remoteURL, err)
+	}
+	defer conn.Close()
+	done := make(chan struct{})
+	link.KeepAlive(conn, done)
+	defer close(done)
+
+	// Closing the connection is what unblocks ReadJSON when ctx ends
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+	}()
+	log.Printf("Relay connected to %s", c.remoteURL)
+
+	_, connected := c.bridge.ConnectedAt()
+	if err := c.send(pluginEvent(connected)); err != nil {
+		return err
+	}
+
+	var cancelsMu sync.Mutex
+	cancels := make(map[string]context.CancelFunc)
+	defer func() {
+		cancelsMu.Lock()
+		for _, cancel := range cancels {
+			cancel()
+		}
+		cancelsMu.Unlock()
+	}()
+
+	for {
+		var msg link.Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			return err
+		}
+		switch msg.Kind {
+		case link.KindRequest:
+			parent := trace.SpanContext{TraceID: msg.TraceID, SpanID: msg.SpanID}
+			origin := bridge.Origin{Node: msg.Origin, Session: msg.Session}
+			timeout := c.timeouts.For(msg.Tool)
+			if msg.TimeoutMs > 0 {
+				timeout = bridge.ClampTimeout(time.Duration(msg.TimeoutMs) * time.Millisecond)
+			}
+			reqCtx, cancel := context.WithTimeout(bridge.WithOrigin(trace.WithRemoteParent(ctx, parent), origin), timeout)
+			reqCtx = bridge.WithProgress(reqCtx, func(p bridge.Progress) {
+				data, _ := json.Marshal(p)
+				_ = c.send(link.Message{Kind: link.KindProgress, ID: msg.ID, Data: data})
+			})
+			cancelsMu.Lock()
+			cancels[msg.ID] = cancel
+			cancelsMu.Unlock()
+
+			go func(msg link.Message) {
+				defer func() {
+					cancelsMu.Lock()
+					delete(cancels, msg.ID)
+					cancelsMu.Unlock()
+					cancel()
+				}()
+				_ = c.send(c.serve(reqCtx, msg))
+			}(msg)
+		case link.KindCancel:
+			cancelsMu.Lock()
+			if cancel := cancels[msg.ID]; cancel != nil {
+				cancel()
+			}
+			cancelsMu.Unlock()
+		case link.KindEvent:
+			if msg.Event == link.EventShutdown {
+				return errHandoff
+			}
+		}
+	}
+}
+
+// serve runs one request from the leader on the local plugin
+func (c *Client) serve(ctx context.Context, msg link.Message) link.Message {
+	resp, err := c.bridge.SendWithParams(ctx, msg.Tool, msg.NodeIDs, msg.Params)
+	reply := link.Message{
+		Kind:   link.KindResponse,
+		ID:     msg.ID,
+		Timing: &link.Timing{PluginMs: float64(resp.Duration.Microseconds()) / 1000},
+	}
+	if errors.Is(err, bridge.ErrNotConnected) {
+		reply.Error = "plugin not connected to the relay: open the Figma MCP Bridge plugin in Figma on the machine running the relay"
+	} else if err != nil {
+		reply.Error = err.Error()
+	} else if reply.Data, err = json.Marshal(resp.Data); err != nil {
+		reply.Error = err.Error()
+	}
+	reply.Code = string(bridge.CodeOf(err))
+	return reply
+}
+
+// send writes a frame on the current tunnel, if any
+func (c *Client) send(msg link.Message) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return nil
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_ = conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return conn.WriteJSON(msg)
+}
+
+func pluginEvent(connected bool) link.Message {
+	data, _ := json.Marshal(link.PluginEvent{Connected: connected})
+	return link.Message{Kind: link.KindEvent, Event: link.EventPlugin, Data: data}
+}
@@ -0,0 +1,41 @@
+// Package relay lets the plugin reach a bridge it cannot connect to
+// directly, e.g. one running in a devcontainer or on an SSH host. A relay
+// process next to Figma owns the plugin WebSocket and dials out to the
+// remote leader over a single authenticated WebSocket; the leader sends
+// tool requests down that tunnel and the relay reports plugin events back.
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/link"
+)
+
+// Path is where the leader accepts relay tunnels
+const Path = "/relay"
+
+// Frames on the tunnel are link.Messages: the leader sends KindRequest and
+// KindCancel, the relay answers with KindResponse and pushes KindEvent with
+// link.EventPlugin. The leader may push link.EventShutdown before a handoff.
+
+func decodeResponse(requestType string, msg link.Message) (bridge.Response, error) {
+	if msg.Error != "" {
+		err := bridge.NewError(bridge.Code(msg.Code), msg.Error+" (via relay)")
+		return bridge.Response{Error: msg.Error, Code: err.Code}, err
+	}
+
+	var data interface{}
+	if len(msg.Data) > 0 {
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			return bridge.Response{}, fmt.Errorf("failed to unmarshal data: %w", err)
+		}
+	}
+	resp := bridge.Response{Type: requestType, Data: data, Bytes: len(msg.Data)}
+	if msg.Timing != nil {
+		resp.Duration = time.Duration(msg.Timing.PluginMs * float64(time.Millisecond))
+	}
+	return resp, nil
+}
@@ -0,0 +1,247 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"figma-mcp-bridge-v2/bridge"
+	"figma-mcp-bridge-v2/link"
+	"figma-mcp-bridge-v2/trace"
+)
+
+// ErrNoRelay is returned by Server.SendWithParams when no relay is connected
+var ErrNoRelay = &bridge.Error{Code: bridge.CodeNotConnected, Message: "no relay connected"}
+
+// relayUpgrader accepts tunnels from relay processes, which are not
+// browsers and send no Origin; the bearer token authenticates them
+var relayUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return r.Header.Get("Origin") == ""
+	},
+}
+
+// Server is the leader's end of the relay tunnel. Only one relay is active
+// at a time; a new one replaces the old, like a reconnecting plugin.
+type Server struct {
+	mu      sync.Mutex
+	tunnel  *tunnel
+	plugin  bool // plugin connected at the relay
+	counter atomic.Uint64
+	onConn  func(connected bool)
+}
+
+type tunnel struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]*call
+}
+
+// call is a request sent down the tunnel and not answered yet
+type call struct {
+	ch       chan link.Message
+	progress func(bridge.Progress)
+}
+
+func (t *tunnel) send(msg link.Message) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_ = t.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return t.conn.WriteJSON(msg)
+}
+
+// NewServer creates a relay endpoint for a leader
+func NewServer() *Server {
+	return &Server{}
+}
+
+// SetConnectionHook registers a function called whenever the plugin behind
+// the relay connects or disconnects. It must be set before serving.
+func (s *Server) SetConnectionHook(hook func(connected bool)) {
+	s.onConn = hook
+}
+
+// Active reports whether a relay tunnel is open
+func (s *Server) Active() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tunnel != nil
+}
+
+// PluginConnected reports whether the plugin is connected at the relay
+func (s *Server) PluginConnected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tunnel != nil && s.plugin
+}
+
+// ServeHTTP upgrades a relay to a tunnel and reads its frames until it goes
+// away. The caller checks the token.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := relayUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Relay upgrade failed: %v", err)
+		return
+	}
+
+	t := &tunnel{conn: conn, pending: make(map[string]*call)}
+	s.mu.Lock()
+	old := s.tunnel
+	s.tunnel = t
+	s.mu.Unlock()
+	if old != nil {
+		old.conn.Close()
+	}
+	log.Printf("Relay connected from %s", r.RemoteAddr)
+
+	done := make(chan struct{})
+	link.KeepAlive(conn, done)
+	defer close(done)
+	defer s.drop(t)
+	for {
+		var msg link.Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		switch msg.Kind {
+		case link.KindResponse:
+			t.mu.Lock()
+			c := t.pending[msg.ID]
+			delete(t.pending, msg.ID)
+			t.mu.Unlock()
+			if c != nil {
+				c.ch <- msg
+			}
+		case link.KindProgress:
+			t.mu.Lock()
+			c := t.pending[msg.ID]
+			t.mu.Unlock()
+			var p bridge.Progress
+			if c != nil && c.progress != nil && json.Unmarshal(msg.Data, &p) == nil {
+				c.progress(p)
+			}
+		case link.KindEvent:
+			if msg.Event == link.EventPlugin {
+				var event link.PluginEvent
+				if err := json.Unmarshal(msg.Data, &event); err == nil {
+					s.setPlugin(t, event.Connected)
+				}
+			}
+		}
+	}
+}
+
+// drop forgets a tunnel that closed and fails its pending requests
+func (s *Server) drop(t *tunnel) {
+	t.conn.Close()
+	t.mu.Lock()
+	for id, c := range t.pending {
+		close(c.ch)
+		delete(t.pending, id)
+	}
+	t.mu.Unlock()
+
+	s.mu.Lock()
+	current := s.tunnel == t
+	if current {
+		s.tunnel = nil
+	}
+	s.mu.Unlock()
+	if current {
+		log.Println("Relay disconnected")
+		s.setPlugin(nil, false)
+	}
+}
+
+func (s *Server) setPlugin(t *tunnel, connected bool) {
+	s.mu.Lock()
+	if t != nil && s.tunnel != t {
+		s.mu.Unlock()
+		return
+	}
+	changed := s.plugin != connected
+	s.plugin = connected
+	s.mu.Unlock()
+	if changed && s.onConn != nil {
+		s.onConn(connected)
+	}
+}
+
+// SendWithParams forwards a request to the plugin behind the relay
+func (s *Server) SendWithParams(ctx context.Context, requestType string, nodeIDs []string, params map[string]interface{}) (resp bridge.Response, err error) {
+	ctx, span := trace.Start(ctx, "relay "+requestType, trace.KindClient)
+	defer func() { span.End(err) }()
+
+	s.mu.Lock()
+	t := s.tunnel
+	s.mu.Unlock()
+	if t == nil {
+		return bridge.Response{}, ErrNoRelay
+	}
+
+	id := "relay-" + strconv.FormatUint(s.counter.Add(1), 10)
+	ch := make(chan link.Message, 1)
+	progress, stopProgress := bridge.AsyncProgress(bridge.ProgressFrom(ctx))
+	defer stopProgress()
+	t.mu.Lock()
+	t.pending[id] = &call{ch: ch, progress: progress}
+	t.mu.Unlock()
+
+	err = t.send(link.Message{
+		Kind:      link.KindRequest,
+		ID:        id,
+		Tool:      requestType,
+		NodeIDs:   nodeIDs,
+		Params:    params,
+		Origin:    bridge.OriginFrom(ctx).Node,
+		Session:   bridge.OriginFrom(ctx).Session,
+		TraceID:   span.Context().TraceID,
+		SpanID:    span.Context().SpanID,
+		TimeoutMs: bridge.TimeoutMillis(ctx),
+	})
+	if err != nil {
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+		return bridge.Response{}, err
+	}
+
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return bridge.Response{}, fmt.Errorf("relay disconnected: %w", bridge.ErrDisconnected)
+		}
+		return decodeResponse(requestType, msg)
+	case <-ctx.Done():
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+		_ = t.send(link.Message{Kind: link.KindCancel, ID: id})
+		return bridge.Response{}, ctx.Err()
+	}
+}
+
+// CloseForRestart tells the relay the leader is going away and closes the
+// tunnel, so the relay reconnects to whoever leads next
+func (s *Server) CloseForRestart(event interface{}) {
+	s.mu.Lock()
+	t := s.tunnel
+	s.mu.Unlock()
+	if t == nil {
+		return
+	}
+	if data, err := json.Marshal(event); err == nil {
+		_ = t.send(link.Message{Kind: link.KindEvent, Event: link.EventShutdown, Data: data})
+	}
+	t.conn.Close()
+}
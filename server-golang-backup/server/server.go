@@ -0,0 +1,108 @@
+// Package server wires a bridge node to an MCP server with the bridge's
+// tools, for figma-bridge and for figmabridge.Server
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"figma-mcp-bridge-v2/config"
+	"figma-mcp-bridge-v2/election"
+	"figma-mcp-bridge-v2/leader"
+	mcpbridge "figma-mcp-bridge-v2/mcp"
+	"figma-mcp-bridge-v2/node"
+)
+
+// Server is a bridge node with the MCP tools registered on an MCP server.
+// It leads or follows like any figma-bridge process sharing its
+// configuration; MCP clients of either role reach the plugin.
+type Server struct {
+	cfg  config.Config
+	node *node.Node
+	mcp  *mcp.Server
+
+	mu           sync.Mutex
+	stopElection func()
+}
+
+// New creates a Server for cfg. With mcpOverHTTP it also serves MCP over
+// streamable HTTP at /mcp whenever it leads. Call Start to join the
+// cluster, and connect MCP clients through MCPServer.
+func New(cfg config.Config, mcpOverHTTP bool) *Server {
+	n := node.New(cfg)
+	server := mcp.NewServer(&mcp.Implementation{
+		Name:    "figma-bridge",
+		Version: leader.Version,
+	}, nil)
+
+	sessions := mcpbridge.NewSessions()
+	server.AddReceivingMiddleware(sessions.Middleware())
+
+	tools := &mcpbridge.Tools{Handler: n, Timeouts: cfg.Timeouts}
+	tools.Register(server)
+	n.SetClients(sessions.ClientNames)
+
+	if mcpOverHTTP {
+		// Every HTTP client shares the same server; the handler keeps one
+		// session per Mcp-Session-Id
+		n.ServeMCP(mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server {
+			return server
+		}, nil))
+	}
+	return &Server{cfg: cfg, node: n, mcp: server}
+}
+
+// MCPServer returns the MCP server with the bridge's tools, e.g. to run it
+// over stdio
+func (s *Server) MCPServer() *mcp.Server {
+	return s.mcp
+}
+
+// Role returns whether the server currently leads or follows
+func (s *Server) Role() node.Role {
+	return s.node.Role()
+}
+
+// Start takes the configured role: it joins the election, or leads or
+// follows unconditionally when the configuration pins the role. A server
+// pinned to lead fails if it cannot.
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch s.cfg.Role {
+	case config.RoleLeader:
+		// No election: lead or fail, so a misconfiguration is loud
+		if err := s.node.BecomeLeader(); err != nil {
+			return fmt.Errorf("cannot start as leader on %s: %w", s.cfg.Addr, err)
+		}
+		s.stopElection = func() {}
+	case config.RoleFollower:
+		// No election either; requests retry until the leader is back
+		s.node.BecomeFollower()
+		log.Printf("Forwarding to leader at %s", s.cfg.LeaderURL)
+		s.stopElection = func() {}
+	default:
+		e := election.New(s.cfg.Locator(), s.node, s.node)
+		s.node.OnLeaderLost(e.CheckNow)
+		e.Start()
+		s.stopElection = e.Stop
+	}
+	return nil
+}
+
+// Stop leaves the cluster, handing off to a follower if this server leads
+func (s *Server) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopElection != nil {
+		s.stopElection()
+		s.stopElection = nil
+	}
+	s.node.Stop()
+}
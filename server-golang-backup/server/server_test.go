@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"figma-mcp-bridge-v2/auth"
+	"figma-mcp-bridge-v2/config"
+	"figma-mcp-bridge-v2/node"
+)
+
+// TestStartTakesPinnedRole starts servers with no leader around: an
+// election would make each of them lead, so only the pin decides
+func TestStartTakesPinnedRole(t *testing.T) {
+	for _, tt := range []struct {
+		role string
+		want node.Role
+	}{
+		{config.RoleAuto, node.RoleLeader},
+		{config.RoleLeader, node.RoleLeader},
+		{config.RoleFollower, node.RoleFollower},
+	} {
+		t.Run(tt.role, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			addr := ln.Addr().String()
+			ln.Close()
+			dir := t.TempDir()
+
+			s := New(config.Config{
+				Addr:           addr,
+				LeaderURL:      config.BaseURL(addr),
+				Token:          "test-token",
+				Role:           tt.role,
+				AllowedOrigins: auth.DefaultOrigins,
+				EpochFile:      filepath.Join(dir, "epoch"),
+				LockFile:       filepath.Join(dir, "run", "leader.lock"),
+			}, false)
+			if err := s.Start(); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(s.Stop)
+			if role := s.Role(); role != tt.want {
+				t.Fatalf("role = %s, want %s", role, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ServiceName is reported as the OTLP service.name resource attribute
+const ServiceName = "figma-bridge"
+
+// The OTLP/JSON encoding of ExportTraceServiceRequest, trimmed to what the
+// bridge sets. IDs are hex and timestamps decimal strings, as the spec says.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              Kind            `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// statusError is the OTLP STATUS_CODE_ERROR
+const statusError = 2
+
+func encodeOTLP(spans []*Span) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           s.sc.TraceID,
+			SpanID:            s.sc.SpanID,
+			ParentSpanID:      s.parent,
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		for _, a := range s.attrs {
+			span.Attributes = append(span.Attributes, otlpAttr(a.key, a.value))
+		}
+		if s.err != "" {
+			span.Status = &otlpStatus{Code: statusError, Message: s.err}
+		}
+		s.mu.Unlock()
+		out = append(out, span)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			otlpAttr("service.name", ServiceName),
+			otlpAttr("process.pid", os.Getpid()),
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "figma-mcp-bridge-v2/trace"},
+			Spans: out,
+		}},
+	}}}
+}
+
+func otlpAttr(key string, value interface{}) otlpAttribute {
+	var v otlpValue
+	switch value := value.(type) {
+	case string:
+		v.StringValue = &value
+	case bool:
+		v.BoolValue = &value
+	case int:
+		s := strconv.Itoa(value)
+		v.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		v.IntValue = &s
+	case uint64:
+		s := strconv.FormatUint(value, 10)
+		v.IntValue = &s
+	case float64:
+		v.DoubleValue = &value
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+	return otlpAttribute{Key: key, Value: v}
+}
+
+// FileExporter appends every span to a file as one OTLP/JSON request per
+// line, the format of the OpenTelemetry collector's file exporter
+type FileExporter struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewFileExporter opens path for appending
+func NewFileExporter(path string) (*FileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+// ExportSpan writes s
+func (e *FileExporter) ExportSpan(s *Span) {
+	req := encodeOTLP([]*Span{s})
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_ = e.enc.Encode(req)
+}
+
+// Close closes the file
+func (e *FileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.file.Close()
+}
+
+const (
+	// Spans are sent in batches of up to this many, or every flushInterval
+	maxBatch      = 256
+	flushInterval = time.Second
+	// Spans beyond this many waiting are dropped rather than slowing calls
+	maxQueued = 4096
+)
+
+// CollectorExporter posts spans in batches to an OTLP/HTTP collector, e.g.
+// http://localhost:4318/v1/traces. Spans may still end while it closes, see
+// SetExporter, so spans is never closed; stop tells run to flush and exit.
+type CollectorExporter struct {
+	endpoint string
+	client   *http.Client
+	spans    chan *Span
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+	warned   bool
+}
+
+// NewCollectorExporter starts exporting to endpoint in the background
+func NewCollectorExporter(endpoint string) *CollectorExporter {
+	e := &CollectorExporter{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		spans:    make(chan *Span, maxQueued),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// ExportSpan queues s, dropping it if the collector cannot keep up or the
+// exporter is closed
+func (e *CollectorExporter) ExportSpan(s *Span) {
+	select {
+	case <-e.stop:
+		return
+	default:
+	}
+	select {
+	case e.spans <- s:
+	default:
+	}
+}
+
+// Close sends the spans still queued and stops the exporter
+func (e *CollectorExporter) Close() error {
+	e.once.Do(func() { close(e.stop) })
+	<-e.done
+	return nil
+}
+
+func (e *CollectorExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	for {
+		select {
+		case s := <-e.spans:
+			if batch = append(batch, s); len(batch) >= maxBatch {
+				e.post(batch)
+				batch = nil
+			}
+		case <-e.stop:
+			e.flush(batch)
+			return
+		case <-ticker.C:
+			e.post(batch)
+			batch = nil
+		}
+	}
+}
+
+// flush posts batch and whatever is still queued. Spans queued by an
+// ExportSpan racing with Close after this are dropped.
+func (e *CollectorExporter) flush(batch []*Span) {
+	for {
+		select {
+		case s := <-e.spans:
+			if batch = append(batch, s); len(batch) >= maxBatch {
+				e.post(batch)
+				batch = nil
+			}
+		default:
+			e.post(batch)
+			return
+		}
+	}
+}
+
+func (e *CollectorExporter) post(batch []*Span) {
+	if len(batch) == 0 {
+		return
+	}
+	body, err := json.Marshal(encodeOTLP(batch))
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("collector answered %s", resp.Status)
+		}
+	}
+	if err != nil && !e.warned {
+		// Only the first failure, a collector that is down would flood the log
+		e.warned = true
+		log.Printf("Exporting spans to %s failed: %v", e.endpoint, err)
+	}
+}
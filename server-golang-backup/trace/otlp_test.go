@@ -0,0 +1,61 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestCollectorExporterCloseWhileEnding ends spans while the exporter they
+// go to is replaced and closed, as SetExporter does at shutdown; run with
+// -race
+func TestCollectorExporterCloseWhileEnding(t *testing.T) {
+	var received atomic.Int64
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err == nil {
+			for _, rs := range req.ResourceSpans {
+				for _, ss := range rs.ScopeSpans {
+					received.Add(int64(len(ss.Spans)))
+				}
+			}
+		}
+	}))
+	defer collector.Close()
+	defer SetExporter(nil)
+
+	for range 20 {
+		e := NewCollectorExporter(collector.URL)
+		SetExporter(e)
+		_, span := Start(context.Background(), "get_selection", KindServer)
+		span.End(nil)
+
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 50 {
+					_, span := Start(context.Background(), "get_node", KindServer)
+					span.SetAttr("tool", "get_node")
+					span.End(nil)
+				}
+			}()
+		}
+		SetExporter(nil)
+		wg.Wait()
+		// Spans ending after the close are dropped, not sent on a closed
+		// channel
+		e.ExportSpan(&Span{})
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if received.Load() == 0 {
+		t.Fatal("no spans reached the collector")
+	}
+}
@@ -0,0 +1,150 @@
+// Package trace follows a tool call from the MCP client through the
+// follower, the leader and the plugin. Spans carry W3C-sized trace and span
+// IDs, are propagated in link messages, RPC bodies and plugin requests, and
+// are exported as OTLP JSON when an exporter is set.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Kind says what side of a hop a span covers
+type Kind int
+
+// Span kinds, numbered as in OTLP
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// SpanContext identifies a span across processes
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+}
+
+// Valid reports whether both IDs are set
+func (sc SpanContext) Valid() bool {
+	return sc.TraceID != "" && sc.SpanID != ""
+}
+
+// Span is one timed step of a request
+type Span struct {
+	name   string
+	kind   Kind
+	sc     SpanContext
+	parent string
+	start  time.Time
+
+	mu    sync.Mutex
+	end   time.Time
+	attrs []attribute
+	err   string
+	ended bool
+}
+
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+type spanKey struct{}
+
+// Start begins a span as a child of the span in ctx, or of a remote parent
+// set with WithRemoteParent, or as the root of a new trace
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	s := &Span{name: name, kind: kind, start: time.Now()}
+	if parent.Valid() {
+		s.sc.TraceID = parent.TraceID
+		s.parent = parent.SpanID
+	} else {
+		s.sc.TraceID = newID(16)
+	}
+	s.sc.SpanID = newID(8)
+	return context.WithValue(ctx, spanKey{}, s.sc), s
+}
+
+// WithRemoteParent makes spans started from ctx children of a span in
+// another process. An invalid sc leaves ctx unchanged.
+func WithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.Valid() {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, sc)
+}
+
+// FromContext returns the current span context, which is invalid if ctx
+// carries none
+func FromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanKey{}).(SpanContext)
+	return sc
+}
+
+// Context returns the IDs to propagate to the next hop
+func (s *Span) Context() SpanContext {
+	return s.sc
+}
+
+// SetAttr records a string, bool, int or float64 attribute
+func (s *Span) SetAttr(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attribute{key, value})
+}
+
+// End finishes the span, marking it failed if err is not nil, and exports
+// it. It returns how long the span took; later calls change nothing.
+func (s *Span) End(err error) time.Duration {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return s.end.Sub(s.start)
+	}
+	s.ended = true
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	s.mu.Unlock()
+
+	if e := current.Load(); e != nil {
+		e.exporter.ExportSpan(s)
+	}
+	return s.end.Sub(s.start)
+}
+
+// Exporter receives every ended span
+type Exporter interface {
+	ExportSpan(s *Span)
+	// Close flushes buffered spans
+	Close() error
+}
+
+type exporterBox struct{ exporter Exporter }
+
+var current atomic.Pointer[exporterBox]
+
+// SetExporter sends ended spans to e, replacing and closing the previous
+// exporter. A nil e stops exporting; IDs are still propagated.
+func SetExporter(e Exporter) {
+	var box *exporterBox
+	if e != nil {
+		box = &exporterBox{e}
+	}
+	if old := current.Swap(box); old != nil {
+		old.exporter.Close()
+	}
+}
+
+func newID(bytes int) string {
+	b := make([]byte, bytes)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -35,6 +35,10 @@ export class Bridge {
     ws.on("message", (data) => {
       try {
         const resp: BridgeResponse = JSON.parse(data.toString());
+        // Progress updates precede the actual response
+        if (resp.type === "progress") {
+          return;
+        }
         const pending = this.pending.get(resp.requestId);
         if (pending) {
           clearTimeout(pending.timeout);